@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"sort"
+)
+
+const maxBookmarks = 9
+
+// SetBookmark marks the position of the current level in a slot from 1
+// to 9, replacing what the slot had
+func (g *Game) SetBookmark(slot int) {
+	level := g.CurrentLevel
+	if level.Bookmarks == nil {
+		level.Bookmarks = map[int]string{}
+	}
+	level.Bookmarks[slot] = level.Moves
+}
+
+func (g *Game) GoToBookmark(slot int) {
+	if moves, ok := g.CurrentLevel.Bookmarks[slot]; ok {
+		g.GoToPosition(moves)
+	}
+}
+
+// GoToPosition builds the level again from moves, so the boxes, the
+// counters and the undo history are the ones of that position. The time,
+// the bookmarks and the branches of the history are kept
+func (g *Game) GoToPosition(moves string) {
+	old := g.CurrentLevel
+	level, err := NewLevel(g.CurrentLevelNum)
+	if err != nil {
+		g.ShowError(err)
+		return
+	}
+	level.Replay(moves)
+	level.Ticks = old.Ticks
+	level.Bookmarks = old.Bookmarks
+	level.History = old.History
+	level.History.Follow(level.Moves)
+
+	g.Levels[g.CurrentLevelNum] = level
+	g.PushTarget = NewPushTarget()
+	g.PendingMoves = ""
+	g.LastMove = MoveResult{BoxIndex: -1}
+}
+
+func (level *Level) DrawBookmarks(screen *ebiten.Image) {
+	slots := make([]int, 0, len(level.Bookmarks))
+	for slot := range level.Bookmarks {
+		slots = append(slots, slot)
+	}
+	sort.Ints(slots)
+
+	for i, slot := range slots {
+		op := &text.DrawOptions{}
+		op.GeoM.Translate(1100, float64(40+i*20))
+		line := fmt.Sprintf("%d: %d moves", slot, countMoves(level.Bookmarks[slot]))
+		text.Draw(screen, line, &text.GoTextFace{Source: mplusFaceSource, Size: 12}, op)
+	}
+}
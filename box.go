@@ -2,107 +2,59 @@ package main
 
 import (
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"image/color"
 )
 
 type Box struct {
 	X     int
 	Y     int
+	Color int
 	Image *ebiten.Image
 }
 
-func NewBox(x int, y int) (Box, error) {
-	image := mustLoadImage("assets/graphics/box.png")
+func NewBox(x int, y int, color int) (Box, error) {
+	if headless {
+		return Box{X: x, Y: y, Color: color}, nil
+	}
+
+	image, err := loadImage("assets/graphics/box.png")
+	if err != nil {
+		return Box{}, err
+	}
 
 	box := Box{
 		X:     x,
 		Y:     y,
-		Image: image,
+		Color: color,
+		Image: tintImage(image, color),
 	}
 	return box, nil
 }
 
 func (box *Box) Draw(screen *ebiten.Image, g *Game) {
 	op := &ebiten.DrawImageOptions{}
-	op.GeoM.Translate(float64(box.X*gd.TileSize), float64(box.Y*gd.TileSize+(gd.TileSize/2)))
+	op.GeoM.Translate(g.CurrentLevel.Topology.Origin(box.X, box.Y))
 	screen.DrawImage(box.Image, op)
 }
 
-func (box *Box) CanMoveRight(level *Level) bool {
-	tileType := level.Tiles[box.Y][box.X+1].TileType
-	if tileType != TileFloor && tileType != TileGoal {
-		return false
-	}
-
-	// miramos si hay una caja en la casilla
-	for _, otherBox := range level.Boxes {
-		if box.Y == otherBox.Y && box.X+1 == otherBox.X {
-			return false
-		}
-	}
-
-	return true
-}
-
-func (box *Box) MoveRight() {
-	box.X++
-}
-
-func (box *Box) CanMoveLeft(level *Level) bool {
-	tileType := level.Tiles[box.Y][box.X-1].TileType
-	if tileType != TileFloor && tileType != TileGoal {
-		return false
-	}
-
-	// miramos si hay una caja en la casilla
-	for _, otherBox := range level.Boxes {
-		if box.Y == otherBox.Y && box.X-1 == otherBox.X {
-			return false
-		}
-	}
-
-	return true
-}
-
-func (box *Box) MoveLeft() {
-	box.X--
-}
-
-func (box *Box) CanMoveUp(level *Level) bool {
-	tileType := level.Tiles[box.Y-1][box.X].TileType
-	if tileType != TileFloor && tileType != TileGoal {
-		return false
+// DrawBlockingBox marks the box that could not be pushed in the last move
+func (g *Game) DrawBlockingBox(screen *ebiten.Image) {
+	if g.LastMove.BoxIndex < 0 || g.LastMove.BoxIndex >= len(g.CurrentLevel.Boxes) {
+		return
 	}
 
-	// miramos si hay una caja en la casilla
-	for _, otherBox := range level.Boxes {
-		if box.Y-1 == otherBox.Y && box.X == otherBox.X {
-			return false
-		}
-	}
-
-	return true
-}
-
-func (box *Box) MoveUp() {
-	box.Y--
+	box := g.CurrentLevel.Boxes[g.LastMove.BoxIndex]
+	size := float32(gd.TileSize)
+	x, y := g.CurrentLevel.Topology.Origin(box.X, box.Y)
+	vector.StrokeRect(screen, float32(x), float32(y), size, size, 4, color.RGBA{0xff, 0x40, 0x40, 0xff}, false)
 }
 
-func (box *Box) CanMoveDown(level *Level) bool {
-	tileType := level.Tiles[box.Y+1][box.X].TileType
-	if tileType != TileFloor && tileType != TileGoal {
+func (box *Box) CanMove(level *Level, d Direction) bool {
+	if !isOpenTile(level.TileTypeAt(box.X+d.DX, box.Y+d.DY)) || !level.CanCross(box.X, box.Y, box.X+d.DX, box.Y+d.DY, d) {
 		return false
 	}
 
-	// miramos si hay una caja en la casilla
-	for _, otherBox := range level.Boxes {
-		if box.Y+1 == otherBox.Y && box.X == otherBox.X {
-			return false
-		}
-	}
-
-	return true
-}
-
-func (box *Box) MoveDown() {
-	box.Y++
+	// miramos si hay una caja o un jugador en la casilla
+	return level.BoxAt(box.X+d.DX, box.Y+d.DY) == -1 && level.PlayerAt(box.X+d.DX, box.Y+d.DY) == -1
 }
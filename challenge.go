@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"image/color"
+)
+
+func (level *Level) DrawBudget(screen *ebiten.Image) {
+	left := 0
+	budget := ""
+	if level.MoveLimit > 0 {
+		left = level.MoveLimit - level.Steps
+		budget = fmt.Sprintf("Moves left: %d", left)
+	} else {
+		left = level.PushLimit - level.Pushes
+		budget = fmt.Sprintf("Pushes left: %d", left)
+	}
+
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(230, 10)
+	if left <= 0 {
+		op.ColorScale.ScaleWithColor(color.RGBA{0xff, 0x60, 0x60, 0xff})
+	}
+	text.Draw(screen, budget, &text.GoTextFace{Source: mplusFaceSource, Size: 16}, op)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"image/color"
+	"strings"
+)
+
+// letters of the coloured goals and boxes in level definitions. A box
+// completes the level only on a goal of its own colour, and plain boxes
+// and goals, which are colour 0, only go with each other
+const (
+	colorGoalLetters = "rgyv"
+	colorBoxLetters  = "RGYV"
+
+	// a coloured box on a goal of its colour, and the player on a coloured
+	// goal, like * and + for the plain ones
+	colorBoxOnGoalLetters    = "KLMN"
+	colorPlayerOnGoalLetters = "klmn"
+)
+
+// colours used to tint the box and goal graphics, from colour 1
+var tileColors = []color.RGBA{
+	{0xff, 0x50, 0x50, 0xff},
+	{0x50, 0xff, 0x50, 0xff},
+	{0xff, 0xff, 0x40, 0xff},
+	{0xc0, 0x60, 0xff, 0xff},
+}
+
+// numColors counts the plain colour too
+const numColors = len(colorGoalLetters) + 1
+
+// colorOf returns the colour of a letter of a level definition, and if it
+// is a box or a goal. Letters that are not coloured return colour 0
+func colorOf(c byte) (int, bool) {
+	if i := strings.IndexByte(colorBoxLetters, c); i != -1 {
+		return i + 1, true
+	}
+	if i := strings.IndexByte(colorGoalLetters, c); i != -1 {
+		return i + 1, false
+	}
+
+	return 0, false
+}
+
+// colorOnGoalOf returns the colour of the goal under a box or a player in a
+// level definition, and if it has a box. Letters of other squares return
+// colour 0
+func colorOnGoalOf(c byte) (int, bool) {
+	if i := strings.IndexByte(colorBoxOnGoalLetters, c); i != -1 {
+		return i + 1, true
+	}
+	if i := strings.IndexByte(colorPlayerOnGoalLetters, c); i != -1 {
+		return i + 1, false
+	}
+
+	return 0, false
+}
+
+// tintImage returns a copy of a graphic in one of the tile colours, or the
+// same graphic for the plain colour and for levels without graphics
+func tintImage(image *ebiten.Image, colorIndex int) *ebiten.Image {
+	if colorIndex == 0 || image == nil {
+		return image
+	}
+
+	tinted := ebiten.NewImage(image.Bounds().Dx(), image.Bounds().Dy())
+	op := &ebiten.DrawImageOptions{}
+	op.ColorScale.ScaleWithColor(tileColors[colorIndex-1])
+	tinted.DrawImage(image, op)
+
+	return tinted
+}
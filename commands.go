@@ -0,0 +1,386 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// runCommand runs the command line tools, so they can be used without
+// opening the game window
+func runCommand(args []string) error {
+	switch args[0] {
+	case "generate":
+		return generateCommand(args[1:])
+	case "rate":
+		return rateCommand(args[1:])
+	case "play":
+		return playCommand(args[1:])
+	case "race":
+		return raceCommand(args[1:])
+	case "serve":
+		return serveCommand(args[1:])
+	case "leaderboard":
+		return leaderboardCommand(args[1:])
+	case "export":
+		return exportCommand(args[1:])
+	case "render":
+		return renderCommand(args[1:])
+	}
+
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+func generateCommand(args []string) error {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	count := flags.Int("count", 10, "number of levels in the pack")
+	width := flags.Int("width", 10, "width of the levels, without the outer walls")
+	height := flags.Int("height", 8, "height of the levels, without the outer walls")
+	boxes := flags.Int("boxes", 3, "number of boxes in each level")
+	seed := flags.Int64("seed", time.Now().UnixNano(), "seed of the random levels")
+	output := flags.String("o", "", "XSB file to write, standard output if empty")
+	flags.Parse(args)
+
+	rng := rand.New(rand.NewSource(*seed))
+	levels, ratings, err := GeneratePack(rng, *count, *width, *height, *boxes)
+	if err != nil {
+		return err
+	}
+
+	titles := make([]string, len(levels))
+	for i, rating := range ratings {
+		titles[i] = fmt.Sprintf("Random %d (seed %d, difficulty %d, %d pushes)", i+1, *seed, rating.Difficulty(), rating.Pushes)
+	}
+
+	if *output == "" {
+		return WriteXSB(os.Stdout, levels, titles)
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return WriteXSB(f, levels, titles)
+}
+
+// rateCommand solves every level of a pack and prints its difficulty, which
+// is how the difficulty in the metadata of the built-in packs is computed
+func rateCommand(args []string) error {
+	flags := flag.NewFlagSet("rate", flag.ExitOnError)
+	pack := flags.String("pack", "easy", "pack to rate: easy, original or an XSB file")
+	nodes := flags.Int("nodes", 1_000_000, "positions the solver can try before estimating")
+	flags.Parse(args)
+
+	levels, err := packDefinition(*pack)
+	if len(levels) == 0 {
+		return err
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	for i, rows := range levels {
+		rating, err := RateLevel(rows, *nodes)
+		if err != nil {
+			fmt.Printf("Level %d: %v\n", i+1, err)
+			continue
+		}
+
+		estimated := ""
+		if !rating.IsSolved {
+			estimated = " (estimated)"
+		}
+		fmt.Printf("Level %d: difficulty %d%s, %d pushes, %d box lines, %d nodes, branching %.1f, dead squares %.0f%%\n",
+			i+1, rating.Difficulty(), estimated, rating.Pushes, rating.BoxLines, rating.Nodes, rating.Branching, 100*rating.DeadDensity)
+	}
+
+	return nil
+}
+
+// playCommand opens the game with the levels of an XSB file, or a Hexoban
+// file with -hex, in the imported mode. Levels with problems are reported
+// before the window opens
+func playCommand(args []string) error {
+	flags := flag.NewFlagSet("play", flag.ExitOnError)
+	hex := flags.Bool("hex", false, "read the pack in the Hexoban format")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("usage: sokomad play [-hex] pack.xsb")
+	}
+
+	read := ReadXSBFile
+	importedLevelsTopology = SquareTopology
+	if *hex {
+		read = ReadHexobanFile
+		importedLevelsTopology = HexTopology
+	}
+
+	levels, err := read(flags.Arg(0))
+	if len(levels) == 0 {
+		if err == nil {
+			err = fmt.Errorf("no levels in %s", flags.Arg(0))
+		}
+		return err
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	importedLevelsDefinition = levels
+	coverSelectedMode = ImportedMode
+
+	return runGame()
+}
+
+// raceCommand hosts a race in a level of a pack, or joins the race hosted
+// at an address, and opens the game in the race mode
+func raceCommand(args []string) error {
+	flags := flag.NewFlagSet("race", flag.ExitOnError)
+	host := flags.String("host", "", "address to host the race at, like :7777")
+	join := flags.String("join", "", "address of the race to join, like localhost:7777")
+	name := flags.String("name", "", "name shown to the other players")
+	pack := flags.String("pack", "easy", "pack of the level when hosting: easy, original or an XSB file")
+	levelNum := flags.Int("level", 1, "level of the pack when hosting")
+	flags.Parse(args)
+	if (*host == "") == (*join == "") {
+		return errors.New("usage: sokomad race -host address [-pack name] [-level n] | -join address [-name name]")
+	}
+
+	var err error
+	if *join != "" {
+		race, err = JoinRace(*join, *name)
+		if err != nil {
+			return err
+		}
+	} else {
+		levels, err := packDefinition(*pack)
+		if *levelNum < 1 || *levelNum > len(levels) {
+			if err == nil {
+				err = fmt.Errorf("no level %d in %s", *levelNum, *pack)
+			}
+			return err
+		}
+
+		if *name == "" {
+			*name = "Host"
+		}
+		race, err = HostRace(*host, *name, levels[*levelNum-1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Hosting level %d of %s at %s\n", *levelNum, *pack, *host)
+	}
+
+	coverSelectedMode = RaceMode
+
+	return runGame()
+}
+
+// serveCommand serves the remote API, where programs can play levels by
+// the rules of the game without a window
+func serveCommand(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	address := flags.String("addr", "localhost:8081", "address to serve the API at")
+	flags.Parse(args)
+
+	fmt.Printf("Serving the remote API at %s\n", *address)
+
+	return ServeRemote(*address)
+}
+
+// leaderboardCommand serves the leaderboard, where the game submits the
+// solutions of the levels that are the same for everyone
+func leaderboardCommand(args []string) error {
+	flags := flag.NewFlagSet("leaderboard", flag.ExitOnError)
+	address := flags.String("addr", ":8082", "address to serve the leaderboard at")
+	data := flags.String("data", "leaderboard.json", "file where the solutions are kept")
+	flags.Parse(args)
+
+	lb, err := LoadLeaderboard(*data)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Serving the leaderboard at %s\n", *address)
+
+	return ServeLeaderboard(*address, lb)
+}
+
+// exportCommand renders the replay of a solution as an animated GIF, or
+// as a folder of PNG frames. Without moves, the solution saved in the
+// profile is replayed
+func exportCommand(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	pack := flags.String("pack", "easy", "pack of the level: easy, original or an XSB file")
+	hex := flags.Bool("hex", false, "read the pack in the Hexoban format")
+	levelNum := flags.Int("level", 1, "level of the pack")
+	moves := flags.String("moves", "", "moves in LURD notation, the saved solution if empty")
+	output := flags.String("o", "solution.gif", "GIF file to write, or folder of PNG frames")
+	format := flags.String("format", "", "gif or png, from the output name if empty")
+	tileSize := flags.Int("tile", exportTileSize, "size of the tiles in pixels")
+	speed := flags.Int("speed", exportSpeed, "milliseconds between moves")
+	flags.Parse(args)
+
+	if *tileSize < 1 {
+		return fmt.Errorf("-tile %d is too small, tiles need at least 1 pixel", *tileSize)
+	}
+	// GIF delays are in hundredths of a second, and a delay of 0 is not
+	// played as fast as possible but at the speed each viewer chooses
+	if *speed < 10 {
+		return fmt.Errorf("-speed %d is too fast, moves need at least 10 milliseconds", *speed)
+	}
+
+	levels, topology, err := commandPack(*pack, *hex)
+	if *levelNum < 1 || *levelNum > len(levels) {
+		if err == nil {
+			err = fmt.Errorf("no level %d in %s", *levelNum, *pack)
+		}
+		return err
+	}
+
+	if *moves == "" {
+		*moves, err = savedSolution(*pack, *levelNum)
+		if err != nil {
+			return err
+		}
+	}
+
+	level, err := headlessLevel(levels, *levelNum-1, topology)
+	if err != nil {
+		return err
+	}
+	r, err := NewRenderer(*tileSize)
+	if err != nil {
+		return err
+	}
+	frames, err := ReplayFrames(level, *moves, r)
+	if err != nil {
+		return err
+	}
+
+	if *format == "" {
+		*format = "png"
+		if strings.EqualFold(filepath.Ext(*output), ".gif") {
+			*format = "gif"
+		}
+	}
+
+	switch *format {
+	case "gif":
+		return WriteGIF(*output, frames, *speed/10)
+	case "png":
+		return WritePNGFrames(*output, frames)
+	}
+
+	return fmt.Errorf("unknown format %q", *format)
+}
+
+// renderCommand draws a level into a PNG file, as it starts or after some
+// moves or the saved solution
+func renderCommand(args []string) error {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	pack := flags.String("pack", "easy", "pack of the level: easy, original or an XSB file")
+	hex := flags.Bool("hex", false, "read the pack in the Hexoban format")
+	levelNum := flags.Int("level", 1, "level of the pack")
+	moves := flags.String("moves", "", "moves in LURD notation to play before drawing")
+	solution := flags.Bool("solution", false, "play the solution saved in the profile before drawing")
+	counters := flags.Bool("counters", false, "write the steps and pushes over the level")
+	output := flags.String("o", "level.png", "PNG file to write")
+	tileSize := flags.Int("tile", 64, "size of the tiles in pixels")
+	flags.Parse(args)
+
+	if *tileSize < 1 {
+		return fmt.Errorf("-tile %d is too small, tiles need at least 1 pixel", *tileSize)
+	}
+
+	levels, topology, err := commandPack(*pack, *hex)
+	if *levelNum < 1 || *levelNum > len(levels) {
+		if err == nil {
+			err = fmt.Errorf("no level %d in %s", *levelNum, *pack)
+		}
+		return err
+	}
+
+	if *solution {
+		if *moves != "" {
+			return errors.New("-moves and -solution can't be used together")
+		}
+		*moves, err = savedSolution(*pack, *levelNum)
+		if err != nil {
+			return err
+		}
+	}
+
+	level, err := headlessLevel(levels, *levelNum-1, topology)
+	if err != nil {
+		return err
+	}
+	for i, move := range []byte(*moves) {
+		if err := level.playMove(move); err != nil {
+			return fmt.Errorf("move %d: %w", i+1, err)
+		}
+	}
+
+	r, err := NewRenderer(*tileSize)
+	if err != nil {
+		return err
+	}
+
+	return WritePNG(*output, r.Render(level, *counters))
+}
+
+// commandPack returns the levels of a built-in pack or of a file, read in
+// the Hexoban format with hex
+func commandPack(name string, hex bool) ([][]string, Topology, error) {
+	if hex {
+		levels, err := ReadHexobanFile(name)
+		return levels, HexTopology, err
+	}
+
+	levels, err := packDefinition(name)
+	return levels, SquareTopology, err
+}
+
+// savedSolution returns the solution of a level of a built-in pack saved in
+// the last profile. The profiles are only read, so the files saved before
+// there were profiles stay where they are until the game is opened
+func savedSolution(pack string, levelNum int) (string, error) {
+	names := listProfiles()
+	if len(names) == 0 {
+		return "", errors.New("no profiles saved yet, give the moves with -moves")
+	}
+	profileName = lastProfile(names)
+	loadProfile()
+
+	moves, ok := profile.Solutions[fmt.Sprintf("%s/%d", pack, levelNum)]
+	if !ok {
+		return "", fmt.Errorf("no solution of level %d of %s saved in profile %s, give the moves with -moves", levelNum, pack, profileName)
+	}
+
+	return moves, nil
+}
+
+// packDefinition returns the levels of a built-in pack or of an XSB file.
+// Levels of an XSB file can come with an error telling which ones have
+// problems
+func packDefinition(name string) ([][]string, error) {
+	switch name {
+	case "easy":
+		return easyLevelsDefinition, nil
+	case "original":
+		return originalLevelsDefinition, nil
+	}
+
+	if strings.EqualFold(filepath.Ext(name), ".xsb") {
+		return ReadXSBFile(name)
+	}
+
+	return nil, fmt.Errorf("unknown pack %q", name)
+}
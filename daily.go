@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"hash/fnv"
+	"math/rand"
+	"time"
+)
+
+// settings of the daily level, which must be the same for everyone
+// so the same date gives the same level
+const (
+	dailyLevelWidth  = 10
+	dailyLevelHeight = 8
+	dailyLevelBoxes  = 3
+)
+
+type DailyResult struct {
+	Moves  int `json:"moves"`
+	Pushes int `json:"pushes"`
+	Ticks  int `json:"ticks"`
+}
+
+// the result line of the last daily level is written in this file of the
+// profile, so it can be copied and shared
+const dailyResultFile = "daily_result.txt"
+
+type Daily struct {
+	Date       string
+	Best       *DailyResult
+	Result     string
+	ResultPath string
+	IsRecord   bool
+}
+
+func NewDaily(date string) *Daily {
+	d := &Daily{Date: date}
+	if best, ok := profile.Daily[date]; ok {
+		d.Best = &best
+	}
+
+	return d
+}
+
+// today returns the date in UTC, so everyone plays the same level at the
+// same time wherever they are
+func today() string {
+	return time.Now().UTC().Format("2006-01-02")
+}
+
+// dailyLevelDefinition generates the level of the given date, seeding the
+// generator with the date itself
+func dailyLevelDefinition(date string) ([]string, error) {
+	h := fnv.New64a()
+	h.Write([]byte("sokomad daily " + date))
+	rng := rand.New(rand.NewSource(int64(h.Sum64())))
+
+	rows, _, err := GenerateLevel(rng, dailyLevelWidth, dailyLevelHeight, dailyLevelBoxes)
+
+	return rows, err
+}
+
+func (r DailyResult) isBetter(other DailyResult) bool {
+	if r.Moves != other.Moves {
+		return r.Moves < other.Moves
+	}
+	if r.Pushes != other.Pushes {
+		return r.Pushes < other.Pushes
+	}
+
+	return r.Ticks < other.Ticks
+}
+
+// Finish keeps the result of the completed level, writing the result line
+// in the profile and saving the result when it's the best of the day
+func (d *Daily) Finish(level *Level) error {
+	result := DailyResult{Moves: level.Steps, Pushes: level.Pushes, Ticks: level.Ticks}
+	d.Result = fmt.Sprintf("SokoMAD daily %s: %d moves, %d pushes, %s", d.Date, result.Moves, result.Pushes, formatTicks(result.Ticks))
+
+	path := profilePath(dailyResultFile)
+	err := writeSaveFile(path, []byte(d.Result+"\n"))
+	if err == nil {
+		d.ResultPath = path
+	}
+
+	if d.Best != nil && !result.isBetter(*d.Best) {
+		return err
+	}
+
+	d.IsRecord = true
+	d.Best = &result
+	if profile.Daily == nil {
+		profile.Daily = map[string]DailyResult{}
+	}
+	profile.Daily[d.Date] = result
+
+	return errors.Join(err, saveProfile())
+}
+
+func (d *Daily) Draw(screen *ebiten.Image) {
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(230, 10)
+	text.Draw(screen, "Daily "+d.Date, &text.GoTextFace{Source: mplusFaceSource, Size: 16}, op)
+}
+
+func (d *Daily) DrawResult(screen *ebiten.Image, y float64) {
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(80, y)
+	text.Draw(screen, d.Result, &text.GoTextFace{Source: mplusFaceSource, Size: 16}, op)
+
+	best := "New best of the day!"
+	if !d.IsRecord {
+		best = fmt.Sprintf("Best of the day: %d moves, %d pushes, %s", d.Best.Moves, d.Best.Pushes, formatTicks(d.Best.Ticks))
+	}
+	op = &text.DrawOptions{}
+	op.GeoM.Translate(80, y+30)
+	text.Draw(screen, best, &text.GoTextFace{Source: mplusFaceSource, Size: 16}, op)
+
+	// the result can't be shared if it couldn't be written
+	if d.ResultPath == "" {
+		return
+	}
+	op = &text.DrawOptions{}
+	op.GeoM.Translate(80, y+60)
+	text.Draw(screen, "Result written in "+d.ResultPath, &text.GoTextFace{Source: mplusFaceSource, Size: 16}, op)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"image/color"
+	"strings"
+)
+
+// characters that fit in a line of the error messages
+const errorLineLength = 70
+
+// wrapText splits a message in lines that fit in the screen
+func wrapText(message string, length int) []string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(message, "\n") {
+		for len(line) > length {
+			cut := strings.LastIndex(line[:length], " ")
+			if cut <= 0 {
+				cut = length
+			}
+			lines = append(lines, line[:cut])
+			line = strings.TrimLeft(line[cut:], " ")
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func DrawError(screen *ebiten.Image, g *Game) {
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(80, 200)
+	op.ColorScale.ScaleWithColor(color.RGBA{0xff, 0x40, 0x40, 0xff})
+	text.Draw(screen, "Something went wrong", &text.GoTextFace{Source: mplusFaceSource, Size: 36}, op)
+
+	y := 300.0
+	for _, line := range wrapText(g.Error.Error(), errorLineLength) {
+		op = &text.DrawOptions{}
+		op.GeoM.Translate(80, y)
+		text.Draw(screen, line, &text.GoTextFace{Source: mplusFaceSource, Size: 16}, op)
+		y += 30
+	}
+
+	op = &text.DrawOptions{}
+	op.GeoM.Translate(80, y+60)
+	text.Draw(screen, "Press space to go back to the cover", &text.GoTextFace{Source: mplusFaceSource, Size: 24}, op)
+}
+
+// DrawSaveError tells the player that the game is running without saving
+func DrawSaveError(screen *ebiten.Image, g *Game) {
+	message := "Not saving: " + g.SaveError.Error()
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(20, float64(gd.TileSize*gd.TilesY))
+	op.ColorScale.ScaleWithColor(color.RGBA{0xff, 0x40, 0x40, 0xff})
+	text.Draw(screen, wrapText(message, 2*errorLineLength)[0], &text.GoTextFace{Source: mplusFaceSource, Size: 8}, op)
+}
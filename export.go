@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"golang.org/x/image/draw"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// time the last frame of an animation stays before it starts again, in
+// hundredths of a second
+const exportFinalDelay = 200
+
+// tile size in pixels and milliseconds between moves of the exports, when
+// they are not chosen in the command line
+const (
+	exportTileSize = 32
+	exportSpeed    = 150
+)
+
+// headlessLevel makes a level of a pack without graphics, to be played and
+// rendered from the command line
+func headlessLevel(levels [][]string, levelNum int, topology Topology) (*Level, error) {
+	headless = true
+	levelsDefinition = levels
+	levelsTopology = topology
+
+	level, err := NewLevel(levelNum)
+	if err != nil {
+		return nil, err
+	}
+
+	return &level, nil
+}
+
+// playMove plays one move in LURD notation, which can also choose the
+// player that makes the next moves. Moves that can't be played are errors
+func (level *Level) playMove(move byte) error {
+	if isPlayerNumber(move) {
+		if int(move-'1') >= len(level.Players) {
+			return fmt.Errorf("no player %c in the level", move)
+		}
+		level.ActivePlayer = int(move - '1')
+		return nil
+	}
+
+	d, ok := level.Topology.DirectionOf(move)
+	if !ok {
+		return fmt.Errorf("unknown move %q", move)
+	}
+
+	result := level.CurrentPlayer().Move(level, d)
+	if result.Outcome != MoveWalked && result.Outcome != MovePushed {
+		return fmt.Errorf("%q is %s", move, result.Outcome)
+	}
+
+	return nil
+}
+
+// ReplayFrames renders the level before the moves and after each of them
+func ReplayFrames(level *Level, moves string, r *Renderer) ([]*image.RGBA, error) {
+	frames := []*image.RGBA{r.Render(level, true)}
+	for i, move := range []byte(moves) {
+		if err := level.playMove(move); err != nil {
+			return nil, fmt.Errorf("move %d: %w", i+1, err)
+		}
+		if !isPlayerNumber(move) {
+			frames = append(frames, r.Render(level, true))
+		}
+	}
+
+	return frames, nil
+}
+
+// WriteGIF writes the frames as an animation with delay hundredths of a
+// second between them, holding the last one a bit longer
+func WriteGIF(name string, frames []*image.RGBA, delay int) error {
+	anim := &gif.GIF{}
+	for i, frame := range frames {
+		paletted := image.NewPaletted(frame.Bounds(), palette.Plan9)
+		draw.Draw(paletted, paletted.Bounds(), frame, image.Point{}, draw.Src)
+		anim.Image = append(anim.Image, paletted)
+
+		if i == len(frames)-1 {
+			anim.Delay = append(anim.Delay, max(delay, exportFinalDelay))
+		} else {
+			anim.Delay = append(anim.Delay, delay)
+		}
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return gif.EncodeAll(f, anim)
+}
+
+// WritePNG writes an image in a PNG file
+func WritePNG(name string, img image.Image) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// WritePNGFrames writes every frame in its own numbered PNG file inside a
+// folder
+func WritePNGFrames(dir string, frames []*image.RGBA) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	for i, frame := range frames {
+		if err := WritePNG(filepath.Join(dir, fmt.Sprintf("frame%04d.png", i)), frame); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Export is the solution of the completed level being written as a GIF in
+// the folder of the profile. It's written in the background, so the game
+// doesn't wait
+type Export struct {
+	mu   sync.Mutex
+	done bool
+	path string
+	err  error
+}
+
+// ExportSolution replays the moves of the completed level from the start
+// and writes them as a GIF named after the mode and the level
+func (g *Game) ExportSolution() {
+	if g.Export != nil {
+		return
+	}
+
+	e := &Export{}
+	g.Export = e
+	level, err := NewLevel(g.CurrentLevelNum)
+	if err != nil {
+		e.finish(err)
+		return
+	}
+
+	name := fmt.Sprintf("%s %d.gif", strings.ToLower(coverSelectedMode.String()), g.CurrentLevelNum+1)
+	if g.Daily != nil {
+		name = fmt.Sprintf("daily %s.gif", g.Daily.Date)
+	}
+	e.path = profilePath(name)
+	go e.write(&level, g.CurrentLevel.Moves)
+}
+
+func (e *Export) write(level *Level, moves string) {
+	r, err := NewRenderer(exportTileSize)
+	if err != nil {
+		e.finish(err)
+		return
+	}
+	frames, err := ReplayFrames(level, moves, r)
+	if err != nil {
+		e.finish(err)
+		return
+	}
+
+	e.finish(WriteGIF(e.path, frames, exportSpeed/10))
+}
+
+func (e *Export) finish(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.done = true
+	e.err = err
+}
+
+// DrawExport tells how to export the solution of the level, or where it
+// was written
+func (g *Game) DrawExport(screen *ebiten.Image, y float64) {
+	line := "G: export the solution as a GIF"
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(420, y)
+	if e := g.Export; e != nil {
+		e.mu.Lock()
+		switch {
+		case !e.done:
+			line = "Exporting..."
+		case e.err != nil:
+			line = "Not exported: " + e.err.Error()
+			op.ColorScale.ScaleWithColor(color.RGBA{0xff, 0x60, 0x60, 0xff})
+		default:
+			line = "Exported to " + e.path
+			op.ColorScale.ScaleWithColor(color.RGBA{0x60, 0xff, 0x60, 0xff})
+		}
+		e.mu.Unlock()
+	}
+
+	text.Draw(screen, line, &text.GoTextFace{Source: mplusFaceSource, Size: 16}, op)
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// 3x3 pieces the generator puts together to build the rooms, rotated and
+// mirrored at random
+var roomTemplates = [][3]string{
+	{"---", "---", "---"},
+	{"#--", "---", "---"},
+	{"##-", "---", "---"},
+	{"###", "---", "---"},
+	{"#--", "#--", "---"},
+	{"---", "-#-", "---"},
+	{"##-", "##-", "---"},
+	{"#-#", "---", "---"},
+	{"--#", "---", "#--"},
+	{"---", "-##", "---"},
+	{"#--", "---", "--#"},
+	{"-#-", "---", "---"},
+}
+
+const (
+	generatorAttempts = 200
+	generatorMaxNodes = 200_000
+)
+
+var errGeneratorFailed = errors.New("could not generate a level with those settings")
+
+// GenerateLevel builds a solvable level with the given inner size and number
+// of boxes. The level definition is padded to the size of the screen
+func GenerateLevel(rng *rand.Rand, width int, height int, boxes int) ([]string, Rating, error) {
+	if width < 3 || height < 3 || width+2 > gd.TilesX || height+2 > gd.TilesY || boxes < 1 {
+		return nil, Rating{}, errGeneratorFailed
+	}
+
+	for attempt := 0; attempt < generatorAttempts; attempt++ {
+		room := generateRoom(rng, width, height)
+		rows, ok := placeBoxes(rng, room, boxes)
+		if !ok {
+			continue
+		}
+
+		b := newBoard(rows)
+		solution, err := b.Solve(generatorMaxNodes)
+		if err != nil {
+			continue
+		}
+
+		// levels solved in a couple of pushes per box are not interesting
+		if solution.Pushes < 3*boxes {
+			continue
+		}
+
+		return rows, b.rate(solution), nil
+	}
+
+	return nil, Rating{}, errGeneratorFailed
+}
+
+// GeneratePack builds count levels sorted from easiest to hardest
+func GeneratePack(rng *rand.Rand, count int, width int, height int, boxes int) ([][]string, []Rating, error) {
+	levels := make([][]string, 0, count)
+	ratings := make([]Rating, 0, count)
+	for i := 0; i < count; i++ {
+		rows, rating, err := GenerateLevel(rng, width, height, boxes)
+		if err != nil {
+			return nil, nil, err
+		}
+		levels = append(levels, rows)
+		ratings = append(ratings, rating)
+	}
+
+	order := make([]int, count)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return ratings[order[i]].Difficulty() < ratings[order[j]].Difficulty()
+	})
+
+	sortedLevels := make([][]string, count)
+	sortedRatings := make([]Rating, count)
+	for i, j := range order {
+		sortedLevels[i] = levels[j]
+		sortedRatings[i] = ratings[j]
+	}
+
+	return sortedLevels, sortedRatings, nil
+}
+
+// generateRoom returns the walls of a room surrounded by walls, built from
+// templates. Only the biggest connected area of floor is kept
+func generateRoom(rng *rand.Rand, width int, height int) [][]bool {
+	walls := make([][]bool, height+2)
+	for y := range walls {
+		walls[y] = make([]bool, width+2)
+		for x := range walls[y] {
+			walls[y][x] = true
+		}
+	}
+
+	for by := 0; by < height; by += 3 {
+		for bx := 0; bx < width; bx += 3 {
+			template := roomTemplates[rng.Intn(len(roomTemplates))]
+			rotation := rng.Intn(4)
+			mirror := rng.Intn(2) == 1
+			for ty := 0; ty < 3; ty++ {
+				for tx := 0; tx < 3; tx++ {
+					x, y := bx+tx, by+ty
+					if x >= width || y >= height {
+						continue
+					}
+
+					sx, sy := tx, ty
+					for r := 0; r < rotation; r++ {
+						sx, sy = 2-sy, sx
+					}
+					if mirror {
+						sx = 2 - sx
+					}
+					walls[y+1][x+1] = template[sy][sx] == '#'
+				}
+			}
+		}
+	}
+
+	// keep the biggest area so the player can reach all the floor
+	area := make([][]int, len(walls))
+	for y := range area {
+		area[y] = make([]int, len(walls[y]))
+	}
+	sizes := []int{0}
+	for y := range walls {
+		for x := range walls[y] {
+			if walls[y][x] || area[y][x] != 0 {
+				continue
+			}
+
+			id := len(sizes)
+			sizes = append(sizes, 0)
+			queue := [][2]int{{x, y}}
+			area[y][x] = id
+			for len(queue) > 0 {
+				square := queue[0]
+				queue = queue[1:]
+				sizes[id]++
+				for _, d := range Directions {
+					nx, ny := square[0]+d.DX, square[1]+d.DY
+					if !walls[ny][nx] && area[ny][nx] == 0 {
+						area[ny][nx] = id
+						queue = append(queue, [2]int{nx, ny})
+					}
+				}
+			}
+		}
+	}
+
+	biggest := 0
+	for id, size := range sizes {
+		if size > sizes[biggest] {
+			biggest = id
+		}
+	}
+	for y := range walls {
+		for x := range walls[y] {
+			if area[y][x] != biggest {
+				walls[y][x] = true
+			}
+		}
+	}
+
+	return walls
+}
+
+// placeBoxes puts the goals and the boxes on them, and then plays
+// backwards, pulling boxes away from the goals. Every position reached
+// this way can be solved by pushing the boxes back
+func placeBoxes(rng *rand.Rand, walls [][]bool, boxes int) ([]string, bool) {
+	height := len(walls)
+	width := len(walls[0])
+
+	rows := make([]string, height)
+	floor := make([]int, 0)
+	for y := range walls {
+		row := make([]byte, width)
+		for x := range walls[y] {
+			if walls[y][x] {
+				row[x] = '#'
+			} else {
+				row[x] = '-'
+				floor = append(floor, y*width+x)
+			}
+		}
+		rows[y] = string(row)
+	}
+
+	if len(floor) < 3*boxes+3 {
+		return nil, false
+	}
+
+	rng.Shuffle(len(floor), func(i, j int) {
+		floor[i], floor[j] = floor[j], floor[i]
+	})
+
+	b := newBoard(rows)
+	goals := floor[:boxes]
+	for _, goal := range goals {
+		b.goals[goal] = true
+	}
+	b.boxes = append([]int(nil), goals...)
+	b.boxColors = make([]int, boxes)
+	b.player = floor[boxes]
+
+	for pull := 0; pull < 40*boxes; pull++ {
+		occupied := b.occupied(b.boxes)
+		reach := b.reachable(b.player, occupied)
+
+		type pullMove struct {
+			box    int
+			player int
+			to     int
+		}
+		pulls := make([]pullMove, 0)
+		for bi, box := range b.boxes {
+			for _, d := range Directions {
+				player, ok := b.step(box, d.DX, d.DY)
+				if !ok || !reach[player] {
+					continue
+				}
+				to, ok := b.step(player, d.DX, d.DY)
+				if !ok || b.walls[to] || occupied[to] {
+					continue
+				}
+
+				pulls = append(pulls, pullMove{box: bi, player: player, to: to})
+			}
+		}
+		if len(pulls) == 0 {
+			break
+		}
+
+		p := pulls[rng.Intn(len(pulls))]
+		b.boxes[p.box] = p.player
+		b.player = p.to
+	}
+
+	// leave the player anywhere in its area
+	reach := b.reachable(b.player, b.occupied(b.boxes))
+	squares := make([]int, 0)
+	for i, ok := range reach {
+		if ok {
+			squares = append(squares, i)
+		}
+	}
+	b.player = squares[rng.Intn(len(squares))]
+
+	for _, box := range b.boxes {
+		if b.goals[box] {
+			return nil, false
+		}
+	}
+
+	return padLevel(b.definition(b.occupied(b.boxes))), true
+}
+
+// definition writes the board back as rows of a level definition, with the
+// given boxes. Walls not touching any floor are left empty
+func (b *board) definition(occupied []bool) []string {
+	rows := make([]string, b.height)
+	for y := 0; y < b.height; y++ {
+		row := make([]byte, b.width)
+		for x := 0; x < b.width; x++ {
+			i := y*b.width + x
+			switch {
+			case b.walls[i] && b.touchesFloor(i):
+				row[x] = '#'
+			case b.walls[i]:
+				row[x] = ' '
+			case i == b.player && b.goals[i]:
+				row[x] = '+'
+			case i == b.player:
+				row[x] = '@'
+			case occupied[i] && b.goals[i]:
+				row[x] = '*'
+			case occupied[i]:
+				row[x] = '$'
+			case b.goals[i]:
+				row[x] = '.'
+			default:
+				row[x] = '-'
+			}
+		}
+		rows[y] = string(row)
+	}
+
+	return rows
+}
+
+func (b *board) touchesFloor(i int) bool {
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			if j, ok := b.step(i, dx, dy); ok && !b.walls[j] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// padLevel centers a level definition in the screen
+func padLevel(rows []string) []string {
+	return padRows(rows, gd.TilesX, gd.TilesY)
+}
+
+// padRows centers the rows of a level definition in a grid of the given
+// size
+func padRows(rows []string, width int, height int) []string {
+	top := (height - len(rows)) / 2
+	padded := make([]string, height)
+	for y := range padded {
+		row := ""
+		if y >= top && y-top < len(rows) {
+			row = rows[y-top]
+		}
+		left := (width - len(row)) / 2
+		padded[y] = strings.Repeat(" ", left) + row + strings.Repeat(" ", width-left-len(row))
+	}
+
+	return padded
+}
@@ -2,7 +2,10 @@ module github.com/madelman/sokomad
 
 go 1.23.0
 
-require github.com/hajimehoshi/ebiten/v2 v2.7.8
+require (
+	github.com/hajimehoshi/ebiten/v2 v2.7.8
+	golang.org/x/image v0.18.0
+)
 
 require (
 	github.com/ebitengine/gomobile v0.0.0-20240518074828-e86332849895 // indirect
@@ -12,7 +15,6 @@ require (
 	github.com/go-text/typesetting v0.1.1-0.20240325125605-c7936fe59984 // indirect
 	github.com/hajimehoshi/go-mp3 v0.3.4 // indirect
 	github.com/jezek/xgb v1.1.1 // indirect
-	golang.org/x/image v0.18.0 // indirect
 	golang.org/x/sync v0.7.0 // indirect
 	golang.org/x/sys v0.20.0 // indirect
 	golang.org/x/text v0.16.0 // indirect
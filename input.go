@@ -22,33 +22,29 @@ func repeatingKeyPressed(key ebiten.Key) bool {
 
 func HandleInputCover(g *Game) {
 	if repeatingKeyPressed(ebiten.KeyDown) {
-		switch coverSelectedMode {
-		case EasyMode:
-			coverSelectedMode = OriginalMode
-		case OriginalMode:
-			coverSelectedMode = QuitMode
-		case QuitMode:
-			coverSelectedMode = EasyMode
+		coverSelectedMode = (coverSelectedMode + 1) % (QuitMode + 1)
+		for !coverSelectedMode.IsAvailable() {
+			coverSelectedMode = (coverSelectedMode + 1) % (QuitMode + 1)
 		}
 	}
 
 	if repeatingKeyPressed(ebiten.KeyUp) {
-		switch coverSelectedMode {
-		case EasyMode:
-			coverSelectedMode = QuitMode
-		case OriginalMode:
-			coverSelectedMode = EasyMode
-		case QuitMode:
-			coverSelectedMode = OriginalMode
+		coverSelectedMode = (coverSelectedMode + QuitMode) % (QuitMode + 1)
+		for !coverSelectedMode.IsAvailable() {
+			coverSelectedMode = (coverSelectedMode + QuitMode) % (QuitMode + 1)
 		}
 	}
 
+	if inpututil.IsKeyJustPressed(ebiten.KeyP) {
+		g.OpenProfiles()
+	}
+
 	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
 		switch coverSelectedMode {
-		case EasyMode, OriginalMode:
-			g.Start()
 		case QuitMode:
 			g.CurrentScene = QuitScene
+		default:
+			g.Start()
 		}
 	}
 }
@@ -60,24 +56,37 @@ func HandleInputExcel(g *Game) {
 }
 
 func HandleInputPlaying(g *Game) {
-	if repeatingKeyPressed(ebiten.KeyDown) {
-		g.CurrentLevel.Player.MoveDown(g)
+	if g.PushTarget.IsSelecting {
+		HandleInputPushTarget(g)
+	} else if !g.CurrentLevel.IsOverBudget() {
+		// when the budget is exceeded, only undo can bring the player back
+		for _, k := range g.CurrentLevel.Topology.Keys() {
+			if repeatingKeyPressed(k.Key) {
+				g.MovePlayer(k.Direction)
+			}
+		}
 	}
 
-	if repeatingKeyPressed(ebiten.KeyUp) {
-		g.CurrentLevel.Player.MoveUp(g)
+	if inpututil.IsKeyJustPressed(ebiten.KeyJ) {
+		g.CurrentLevel.RemoveMovement()
+		g.LastMove = MoveResult{BoxIndex: -1}
 	}
 
-	if repeatingKeyPressed(ebiten.KeyLeft) {
-		g.CurrentLevel.Player.MoveLeft(g)
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		g.SelectSquare(g.CurrentLevel.Topology.SquareAt(ebiten.CursorPosition()))
 	}
 
-	if repeatingKeyPressed(ebiten.KeyRight) {
-		g.CurrentLevel.Player.MoveRight(g)
+	if inpututil.IsKeyJustPressed(ebiten.KeyT) {
+		selecting := !g.PushTarget.IsSelecting
+		g.PushTarget = NewPushTarget()
+		g.PushTarget.IsSelecting = selecting
+		g.PushTarget.CursorX = g.CurrentLevel.CurrentPlayer().X
+		g.PushTarget.CursorY = g.CurrentLevel.CurrentPlayer().Y
 	}
 
-	if inpututil.IsKeyJustPressed(ebiten.KeyJ) {
-		g.CurrentLevel.RemoveMovement()
+	if inpututil.IsKeyJustPressed(ebiten.KeyTab) {
+		g.CurrentLevel.SwitchPlayer()
+		g.LastMove = MoveResult{BoxIndex: -1}
 	}
 
 	if inpututil.IsKeyJustPressed(ebiten.KeyF) {
@@ -86,12 +95,19 @@ func HandleInputPlaying(g *Game) {
 
 	if inpututil.IsKeyJustPressed(ebiten.KeyR) {
 		g.RestartLevel()
+		// starting fresh forgets the saved position
+		g.CheckSave(g.SavePosition())
 	}
 
-	if inpututil.IsKeyJustPressed(ebiten.KeyZ) {
+	// levels can't be skipped back during a time attack run
+	if inpututil.IsKeyJustPressed(ebiten.KeyZ) && g.TimeAttack == nil {
 		g.PreviousLevel()
 	}
 
+	if inpututil.IsKeyJustPressed(ebiten.KeyL) && g.TimeAttack == nil {
+		g.OpenLevelSelect()
+	}
+
 	if inpututil.IsKeyJustPressed(ebiten.KeyX) {
 		g.CurrentScene = ExcelScene
 	}
@@ -100,15 +116,185 @@ func HandleInputPlaying(g *Game) {
 		g.ShowHelp = !g.ShowHelp
 	}
 
+	if inpututil.IsKeyJustPressed(ebiten.KeyO) {
+		g.ShowReach = !g.ShowReach
+		g.Reachability = Reachability{}
+	}
+
+	// Ctrl and a number marks the position, the number alone goes back to it
+	for slot := 1; slot <= maxBookmarks; slot++ {
+		if !inpututil.IsKeyJustPressed(ebiten.Key0 + ebiten.Key(slot)) {
+			continue
+		}
+
+		if ebiten.IsKeyPressed(ebiten.KeyControl) {
+			g.SetBookmark(slot)
+		} else {
+			g.GoToBookmark(slot)
+		}
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyU) {
+		g.OpenHistory()
+	}
+
 	if inpututil.IsKeyJustPressed(ebiten.KeyQ) {
 		g.RestartMode()
 	}
 }
 
+func HandleInputPushTarget(g *Game) {
+	// the cursor moves like the player, so it stays on the squares of the
+	// grid
+	for _, k := range g.CurrentLevel.Topology.Keys() {
+		if !repeatingKeyPressed(k.Key) {
+			continue
+		}
+
+		x, y := g.PushTarget.CursorX+k.Direction.DX, g.PushTarget.CursorY+k.Direction.DY
+		if y >= 0 && y < len(g.CurrentLevel.Tiles) && x >= 0 && x < len(g.CurrentLevel.Tiles[y]) {
+			g.PushTarget.CursorX, g.PushTarget.CursorY = x, y
+		}
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		g.SelectSquare(g.PushTarget.CursorX, g.PushTarget.CursorY)
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.PushTarget = NewPushTarget()
+	}
+}
+
+func HandleInputPendingMoves(g *Game) {
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.PendingMoves = ""
+		return
+	}
+
+	g.PlayPendingMoves()
+}
+
+func HandleInputHistory(g *Game) {
+	branches := len(g.CurrentLevel.History.Branches())
+	if repeatingKeyPressed(ebiten.KeyDown) && g.SelectedBranch < branches-1 {
+		g.SelectedBranch++
+	}
+
+	if repeatingKeyPressed(ebiten.KeyUp) && g.SelectedBranch > 0 {
+		g.SelectedBranch--
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		g.GoToBranch()
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyU) || inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.ShowHistory = false
+	}
+}
+
+func HandleInputLevelSelect(g *Game) {
+	if repeatingKeyPressed(ebiten.KeyDown) && g.SelectedLevel < len(g.Order)-1 {
+		g.SelectedLevel++
+	}
+
+	if repeatingKeyPressed(ebiten.KeyUp) && g.SelectedLevel > 0 {
+		g.SelectedLevel--
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyS) {
+		g.ToggleLevelSort()
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		g.SelectLevel()
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.CurrentScene = PlayingScene
+	}
+}
+
+func HandleInputProfiles(g *Game) {
+	m := &g.ProfileMenu
+
+	if m.IsTyping {
+		for _, r := range ebiten.AppendInputChars(nil) {
+			if len(m.Input) < maxProfileName {
+				m.Input += string(r)
+			}
+		}
+
+		if repeatingKeyPressed(ebiten.KeyBackspace) && len(m.Input) > 0 {
+			runes := []rune(m.Input)
+			m.Input = string(runes[:len(runes)-1])
+		}
+
+		if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+			m.FinishTyping()
+		}
+
+		if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+			m.IsTyping = false
+			m.Message = ""
+		}
+		return
+	}
+
+	if m.IsDeleting {
+		if inpututil.IsKeyJustPressed(ebiten.KeyY) {
+			m.Delete()
+		}
+
+		if inpututil.IsKeyJustPressed(ebiten.KeyN) || inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+			m.IsDeleting = false
+		}
+		return
+	}
+
+	if repeatingKeyPressed(ebiten.KeyDown) && m.Selected < len(m.Names)-1 {
+		m.Selected++
+	}
+
+	if repeatingKeyPressed(ebiten.KeyUp) && m.Selected > 0 {
+		m.Selected--
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyN) {
+		m.StartTyping(false)
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyR) && len(m.Names) > 0 {
+		m.StartTyping(true)
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyD) && len(m.Names) > 0 {
+		m.IsDeleting = true
+		m.Message = ""
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		g.ChooseProfile()
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.CurrentScene = CoverScene
+	}
+}
+
 func HandleInputCompleted(g *Game) {
 	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
 		g.NextLevel()
 	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyS) {
+		g.SubmitSolution()
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyG) {
+		g.ExportSolution()
+	}
 }
 
 func HandleInputEnd(g *Game) {
@@ -116,3 +302,10 @@ func HandleInputEnd(g *Game) {
 		g.RestartMode()
 	}
 }
+
+func HandleInputError(g *Game) {
+	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+		g.Error = nil
+		g.RestartMode()
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"image/color"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// time the game waits for the leaderboard server to answer a submission
+const leaderboardTimeout = 10 * time.Second
+
+var errNotSolved = errors.New("the moves don't complete the level")
+
+// LeaderboardEntry is a solution accepted by the leaderboard server
+type LeaderboardEntry struct {
+	Name     string `json:"name"`
+	Moves    int    `json:"moves"`
+	Pushes   int    `json:"pushes"`
+	Solution string `json:"solution"`
+	Date     string `json:"date"`
+}
+
+// LeaderboardRank is the place of a player in the ranking of a level
+type LeaderboardRank struct {
+	Rank   int    `json:"rank"`
+	Name   string `json:"name"`
+	Moves  int    `json:"moves"`
+	Pushes int    `json:"pushes"`
+}
+
+// LeaderboardSubmission is a solution sent to the leaderboard server. The
+// level is named like the solutions of the profile, as pack/number, or
+// daily/date for the daily levels
+type LeaderboardSubmission struct {
+	Level string `json:"level"`
+	Name  string `json:"name"`
+	Moves string `json:"moves"`
+}
+
+// LeaderboardResult is the answer of the server to a submission
+type LeaderboardResult struct {
+	Moves      int    `json:"moves"`
+	Pushes     int    `json:"pushes"`
+	RankMoves  int    `json:"rank_moves"`
+	RankPushes int    `json:"rank_pushes"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Leaderboard keeps the accepted solutions of every level in a JSON file
+type Leaderboard struct {
+	mu     sync.Mutex
+	path   string
+	Levels map[string][]LeaderboardEntry `json:"levels"`
+}
+
+// leaderboardLevel returns the definition of a level named like in the
+// submissions. Only levels that are the same for everyone can be ranked
+func leaderboardLevel(key string) ([]string, error) {
+	pack, id, _ := strings.Cut(key, "/")
+	if pack == "daily" {
+		if _, err := time.Parse("2006-01-02", id); err != nil {
+			return nil, fmt.Errorf("unknown level %q", key)
+		}
+		return dailyLevelDefinition(id)
+	}
+
+	var levels [][]string
+	switch pack {
+	case "easy":
+		levels = easyLevelsDefinition
+	case "original":
+		levels = originalLevelsDefinition
+	}
+
+	n, err := strconv.Atoi(id)
+	if err != nil || n < 1 || n > len(levels) {
+		return nil, fmt.Errorf("unknown level %q", key)
+	}
+
+	return levels[n-1], nil
+}
+
+// leaderboardKey names the current level for the leaderboard, or returns
+// an empty key when it can't be ranked
+func (g *Game) leaderboardKey() string {
+	if g.Daily != nil {
+		return "daily/" + g.Daily.Date
+	}
+
+	return solutionKey(g.CurrentLevelNum)
+}
+
+// verifySolution plays moves in LURD notation by the rules of the game and
+// returns the moves and pushes of the solution. Every move must be
+// possible, with pushes in uppercase, and the last one must complete the
+// level
+func verifySolution(rows []string, moves string) (int, int, error) {
+	levelsDefinition = [][]string{rows}
+	levelsTopology = SquareTopology
+	level, err := NewLevel(0)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for i, move := range []byte(moves) {
+		if level.IsLevelCompleted() {
+			return 0, 0, fmt.Errorf("move %d: the level is already completed", i+1)
+		}
+
+		if isPlayerNumber(move) {
+			if int(move-'1') >= len(level.Players) {
+				return 0, 0, fmt.Errorf("move %d: no player %c in the level", i+1, move)
+			}
+			level.ActivePlayer = int(move - '1')
+			continue
+		}
+
+		d, ok := level.Topology.DirectionOf(move)
+		if !ok {
+			return 0, 0, fmt.Errorf("move %d: unknown move %q", i+1, move)
+		}
+
+		result := level.CurrentPlayer().Move(&level, d)
+		switch {
+		case result.Outcome == MoveWalked && move == d.Move:
+		case result.Outcome == MovePushed && move == d.PushMove():
+		case result.Outcome == MoveWalked || result.Outcome == MovePushed:
+			return 0, 0, fmt.Errorf("move %d: %q is %s", i+1, move, result.Outcome)
+		default:
+			return 0, 0, fmt.Errorf("move %d: %s", i+1, result.Outcome)
+		}
+	}
+
+	if !level.IsLevelCompleted() {
+		return 0, 0, errNotSolved
+	}
+
+	return level.Steps, level.Pushes, nil
+}
+
+// LoadLeaderboard reads the solutions saved in a file, which may not exist
+// yet
+func LoadLeaderboard(path string) (*Leaderboard, error) {
+	lb := &Leaderboard{path: path, Levels: map[string][]LeaderboardEntry{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return lb, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, lb); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if lb.Levels == nil {
+		lb.Levels = map[string][]LeaderboardEntry{}
+	}
+
+	return lb, nil
+}
+
+func (lb *Leaderboard) save() error {
+	data, err := json.MarshalIndent(lb, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(lb.path, data, 0777)
+}
+
+// ServeLeaderboard serves the leaderboard until the server fails
+func ServeLeaderboard(address string, lb *Leaderboard) error {
+	headless = true
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /submit", lb.serveSubmit)
+	mux.HandleFunc("GET /rankings", lb.serveRankings)
+
+	return http.ListenAndServe(address, mux)
+}
+
+// serveSubmit checks a solution against the level before keeping it, and
+// tells the places of the player in the rankings of the level
+func (lb *Leaderboard) serveSubmit(w http.ResponseWriter, req *http.Request) {
+	var sub LeaderboardSubmission
+	if err := json.NewDecoder(req.Body).Decode(&sub); err != nil {
+		writeJSON(w, http.StatusBadRequest, LeaderboardResult{Error: err.Error()})
+		return
+	}
+	if strings.TrimSpace(sub.Name) == "" {
+		writeJSON(w, http.StatusBadRequest, LeaderboardResult{Error: "the name is empty"})
+		return
+	}
+
+	rows, err := leaderboardLevel(sub.Level)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, LeaderboardResult{Error: err.Error()})
+		return
+	}
+
+	// the levels of the game are global, so solutions are checked one at
+	// a time
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	moves, pushes, err := verifySolution(rows, sub.Moves)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, LeaderboardResult{Error: err.Error()})
+		return
+	}
+
+	entry := LeaderboardEntry{Name: sub.Name, Moves: moves, Pushes: pushes, Solution: sub.Moves, Date: time.Now().Format(time.RFC3339)}
+	isNew := true
+	for _, e := range lb.Levels[sub.Level] {
+		if e.Name == entry.Name && e.Solution == entry.Solution {
+			isNew = false
+		}
+	}
+	if isNew {
+		lb.Levels[sub.Level] = append(lb.Levels[sub.Level], entry)
+		if err := lb.save(); err != nil {
+			writeJSON(w, http.StatusInternalServerError, LeaderboardResult{Error: err.Error()})
+			return
+		}
+	}
+
+	result := LeaderboardResult{Moves: moves, Pushes: pushes}
+	for _, r := range lb.ranking(sub.Level, false) {
+		if r.Name == sub.Name {
+			result.RankMoves = r.Rank
+		}
+	}
+	for _, r := range lb.ranking(sub.Level, true) {
+		if r.Name == sub.Name {
+			result.RankPushes = r.Rank
+		}
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// serveRankings returns the ranking of a level by moves, or by pushes with
+// by=pushes
+func (lb *Leaderboard) serveRankings(w http.ResponseWriter, req *http.Request) {
+	key := req.URL.Query().Get("level")
+	if _, err := leaderboardLevel(key); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, lb.ranking(key, req.URL.Query().Get("by") == "pushes"))
+}
+
+// ranking returns the best solution of each player of a level, by moves
+// and then pushes, or by pushes and then moves. Ties go to the first one
+// sent. The lock must be held
+func (lb *Leaderboard) ranking(key string, byPushes bool) []LeaderboardRank {
+	better := func(a LeaderboardEntry, b LeaderboardEntry) bool {
+		first, second := []int{a.Moves, a.Pushes}, []int{b.Moves, b.Pushes}
+		if byPushes {
+			first, second = []int{a.Pushes, a.Moves}, []int{b.Pushes, b.Moves}
+		}
+		if first[0] != second[0] {
+			return first[0] < second[0]
+		}
+		if first[1] != second[1] {
+			return first[1] < second[1]
+		}
+		return a.Date < b.Date
+	}
+
+	best := map[string]LeaderboardEntry{}
+	for _, e := range lb.Levels[key] {
+		if b, ok := best[e.Name]; !ok || better(e, b) {
+			best[e.Name] = e
+		}
+	}
+
+	entries := make([]LeaderboardEntry, 0, len(best))
+	for _, e := range best {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return better(entries[i], entries[j])
+	})
+
+	ranking := make([]LeaderboardRank, len(entries))
+	for i, e := range entries {
+		ranking[i] = LeaderboardRank{Rank: i + 1, Name: e.Name, Moves: e.Moves, Pushes: e.Pushes}
+	}
+
+	return ranking
+}
+
+// Submission is a solution being sent to the leaderboard from the level
+// complete screen. It's sent in the background, so the game doesn't wait
+type Submission struct {
+	mu     sync.Mutex
+	done   bool
+	result LeaderboardResult
+	err    error
+}
+
+// SubmitSolution sends the moves of the completed level to the leaderboard
+// of the profile
+func (g *Game) SubmitSolution() {
+	key := g.leaderboardKey()
+	if profile.LeaderboardURL == "" || key == "" || g.Submission != nil {
+		return
+	}
+
+	sub := LeaderboardSubmission{Level: key, Name: profileName, Moves: g.CurrentLevel.Moves}
+	s := &Submission{}
+	g.Submission = s
+	go s.send(strings.TrimRight(profile.LeaderboardURL, "/")+"/submit", sub)
+}
+
+func (s *Submission) send(url string, sub LeaderboardSubmission) {
+	var result LeaderboardResult
+	err := func() error {
+		body, err := json.Marshal(sub)
+		if err != nil {
+			return err
+		}
+
+		client := &http.Client{Timeout: leaderboardTimeout}
+		resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("%s: %s", url, resp.Status)
+		}
+		if result.Error != "" {
+			return errors.New(result.Error)
+		}
+
+		return nil
+	}()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done = true
+	s.result = result
+	s.err = err
+}
+
+// DrawSubmission tells how to submit the solution of the level, or how the
+// submission went
+func (g *Game) DrawSubmission(screen *ebiten.Image, y float64) {
+	if profile.LeaderboardURL == "" || g.leaderboardKey() == "" {
+		return
+	}
+
+	line := "S: submit to the leaderboard"
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(420, y)
+	if s := g.Submission; s != nil {
+		s.mu.Lock()
+		switch {
+		case !s.done:
+			line = "Submitting..."
+		case s.err != nil:
+			line = "Not submitted: " + s.err.Error()
+			op.ColorScale.ScaleWithColor(color.RGBA{0xff, 0x60, 0x60, 0xff})
+		default:
+			line = fmt.Sprintf("Leaderboard: #%d by moves, #%d by pushes", s.result.RankMoves, s.result.RankPushes)
+			op.ColorScale.ScaleWithColor(color.RGBA{0x60, 0xff, 0x60, 0xff})
+		}
+		s.mu.Unlock()
+	}
+
+	text.Draw(screen, line, &text.GoTextFace{Source: mplusFaceSource, Size: 16}, op)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVerifySolution(t *testing.T) {
+	headless = true
+	rows, err := parseLevel([]string{
+		"######",
+		"#@-$.#",
+		"######",
+	}, SquareTopology)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		moves  string
+		steps  int
+		pushes int
+		ok     bool
+	}{
+		{"solution", "rR", 2, 1, true},
+		{"first player chosen", "1rR", 2, 1, true},
+		{"push written as a walk", "rr", 0, 0, false},
+		{"walk written as a push", "RR", 0, 0, false},
+		{"moves after completion", "rRl", 0, 0, false},
+		{"player that doesn't exist", "2rR", 0, 0, false},
+		{"unknown move", "rx", 0, 0, false},
+		{"move into a wall", "urR", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, pushes, err := verifySolution(rows, tt.moves)
+			if tt.ok && err != nil {
+				t.Fatalf("verifySolution(%q) failed: %v", tt.moves, err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatalf("verifySolution(%q) accepted a wrong solution", tt.moves)
+			}
+			if steps != tt.steps || pushes != tt.pushes {
+				t.Errorf("verifySolution(%q) = %d steps, %d pushes, want %d, %d", tt.moves, steps, pushes, tt.steps, tt.pushes)
+			}
+		})
+	}
+}
+
+func TestVerifySolutionNotSolved(t *testing.T) {
+	headless = true
+	rows, err := parseLevel([]string{
+		"######",
+		"#@-$.#",
+		"######",
+	}, SquareTopology)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, moves := range []string{"", "r", "rl"} {
+		if _, _, err := verifySolution(rows, moves); !errors.Is(err, errNotSolved) {
+			t.Errorf("verifySolution(%q) = %v, want %v", moves, err, errNotSolved)
+		}
+	}
+}
+
+func TestRanking(t *testing.T) {
+	lb := &Leaderboard{Levels: map[string][]LeaderboardEntry{
+		"easy/1": {
+			{Name: "ana", Moves: 10, Pushes: 3, Date: "2026-01-02T00:00:00Z"},
+			{Name: "ana", Moves: 12, Pushes: 1, Date: "2026-01-01T00:00:00Z"},
+			{Name: "ben", Moves: 10, Pushes: 2, Date: "2026-01-04T00:00:00Z"},
+			{Name: "cy", Moves: 9, Pushes: 5, Date: "2026-01-05T00:00:00Z"},
+			{Name: "dee", Moves: 10, Pushes: 2, Date: "2026-01-03T00:00:00Z"},
+		},
+	}}
+
+	tests := []struct {
+		name     string
+		byPushes bool
+		want     []LeaderboardRank
+	}{
+		{"by moves", false, []LeaderboardRank{
+			{1, "cy", 9, 5},
+			{2, "dee", 10, 2},
+			{3, "ben", 10, 2},
+			{4, "ana", 10, 3},
+		}},
+		{"by pushes", true, []LeaderboardRank{
+			{1, "ana", 12, 1},
+			{2, "dee", 10, 2},
+			{3, "ben", 10, 2},
+			{4, "cy", 9, 5},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lb.ranking("easy/1", tt.byPushes)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ranking() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubmitDuplicate(t *testing.T) {
+	headless = true
+	solution, err := newBoard(easyLevelsDefinition[0]).Solve(100_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lb, err := LoadLeaderboard(filepath.Join(t.TempDir(), "leaderboard.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	submit := func(name string) LeaderboardResult {
+		body, _ := json.Marshal(LeaderboardSubmission{Level: "easy/1", Name: name, Moves: solution.Moves})
+		w := httptest.NewRecorder()
+		lb.serveSubmit(w, httptest.NewRequest("POST", "/submit", bytes.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("submit by %s: %d %s", name, w.Code, w.Body)
+		}
+
+		var result LeaderboardResult
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	submit("ana")
+	submit("ana")
+	if n := len(lb.Levels["easy/1"]); n != 1 {
+		t.Fatalf("the same solution was kept %d times", n)
+	}
+	// solutions sent in the same second tie, so the first one is made older
+	lb.Levels["easy/1"][0].Date = "2000-01-01T00:00:00Z"
+
+	result := submit("ben")
+	if n := len(lb.Levels["easy/1"]); n != 2 {
+		t.Fatalf("%d solutions kept, want 2", n)
+	}
+	if result.RankMoves != 2 || result.RankPushes != 2 {
+		t.Errorf("ben ranks %d by moves and %d by pushes, want 2 and 2", result.RankMoves, result.RankPushes)
+	}
+
+	// the file keeps the same solutions
+	saved, err := LoadLeaderboard(lb.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(saved.Levels, lb.Levels) {
+		t.Errorf("saved %v, want %v", saved.Levels, lb.Levels)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/text/v2"
 	"image/color"
+	"strings"
 )
 
 const (
@@ -14,16 +15,28 @@ const (
 	TileGoal   string = "goal"
 	TilePlayer string = "player"
 	TileEmpty  string = "empty"
+
+	// special floor squares, drawn over the floor graphic
+	TileIce      string = "ice"
+	TileOneWay   string = "oneway"
+	TileTeleport string = "teleport"
 )
 
+// players of a level are numbered from 1 to 9 in the recorded moves
+const maxPlayers = 9
+
 type Tile struct {
 	X        int
 	Y        int
 	TileType string
+	Color    int
+	OneWay   Direction
+	Teleport int
 	Image    *ebiten.Image
 }
 
 type Movement struct {
+	PlayerIndex int
 	PlayerLastX int
 	PlayerLastY int
 	HasPush     bool
@@ -32,30 +45,60 @@ type Movement struct {
 	BoxLastY    int
 }
 
+// LevelMetadata keeps the information about a level that is not part of
+// its definition. A limit of 0 means the level has no budget, and a
+// difficulty of 0 that the level is unrated
+type LevelMetadata struct {
+	MoveLimit  int
+	PushLimit  int
+	Difficulty int
+}
+
 type Level struct {
 	Tiles         [][]Tile
 	Boxes         []Box
-	Player        Player
+	BoxGrid       [][]int
+	Players       []Player
+	ActivePlayer  int
 	Steps         int
 	Pushes        int
+	Ticks         int
+	MoveLimit     int
+	PushLimit     int
 	IsCompleted   bool
 	LastMovements []Movement
+	Moves         string
+	Bookmarks     map[int]string
+	History       *MoveTree
+	Topology      Topology
+	Teleports     map[[2]int][2]int
 }
 
-func NewLevel(numLevel int) Level {
-	l := Level{}
-	l.createTiles(numLevel)
+func NewLevel(numLevel int) (Level, error) {
+	l := Level{History: NewMoveTree(), Topology: levelsTopology}
+	err := l.createTiles(numLevel)
+	if err != nil {
+		return l, err
+	}
+
+	if coverSelectedMode == ChallengeMode && numLevel < len(levelsMetadata) {
+		l.MoveLimit = levelsMetadata[numLevel].MoveLimit
+		l.PushLimit = levelsMetadata[numLevel].PushLimit
+	}
 
-	return l
+	return l, nil
 }
 
 func (level *Level) Draw(screen *ebiten.Image, g *Game) {
-	for x := 0; x < gd.TilesX; x++ {
-		for y := 0; y < gd.TilesY; y++ {
-			tile := level.Tiles[y][x]
-			op := &ebiten.DrawImageOptions{}
-			op.GeoM.Translate(float64(tile.X*gd.TileSize), float64(tile.Y*gd.TileSize+(gd.TileSize/2)))
-			screen.DrawImage(tile.Image, op)
+	if level.Topology == HexTopology {
+		level.drawHexTiles(screen)
+	} else {
+		for _, row := range level.Tiles {
+			for _, tile := range row {
+				op := &ebiten.DrawImageOptions{}
+				op.GeoM.Translate(level.Topology.Origin(tile.X, tile.Y))
+				screen.DrawImage(tile.Image, op)
+			}
 		}
 	}
 
@@ -65,6 +108,11 @@ func (level *Level) Draw(screen *ebiten.Image, g *Game) {
 	score := fmt.Sprintf("Level: %d/%d", g.CurrentLevelNum+1, len(g.Levels))
 	text.Draw(screen, score, &text.GoTextFace{Source: mplusFaceSource, Size: 16}, op)
 
+	op = &text.DrawOptions{}
+	op.GeoM.Translate(610, 10)
+	time := "Time: " + formatTicks(level.Ticks)
+	text.Draw(screen, time, &text.GoTextFace{Source: mplusFaceSource, Size: 16}, op)
+
 	op = &text.DrawOptions{}
 	op.GeoM.Translate(850, 10)
 	steps := fmt.Sprintf("Steps: %d", level.Steps)
@@ -78,7 +126,8 @@ func (level *Level) Draw(screen *ebiten.Image, g *Game) {
 
 func (level *Level) IsLevelCompleted() bool {
 	for _, box := range level.Boxes {
-		if level.Tiles[box.Y][box.X].TileType != TileGoal {
+		tile := level.Tiles[box.Y][box.X]
+		if tile.TileType != TileGoal || tile.Color != box.Color {
 			return false
 		}
 	}
@@ -86,8 +135,29 @@ func (level *Level) IsLevelCompleted() bool {
 	return true
 }
 
+// IsOverBudget tells if the level has been failed in challenge mode
+func (level *Level) IsOverBudget() bool {
+	if level.MoveLimit > 0 && level.Steps > level.MoveLimit {
+		return true
+	}
+
+	return level.PushLimit > 0 && level.Pushes > level.PushLimit
+}
+
 func newTile(x int, y int, tileType string) (Tile, error) {
-	image := mustLoadImage("assets/graphics/" + tileType + ".png")
+	name := tileType
+	if tileType == TileIce || tileType == TileOneWay || tileType == TileTeleport {
+		name = TileFloor
+	}
+
+	if headless {
+		return Tile{X: x, Y: y, TileType: tileType}, nil
+	}
+
+	image, err := loadImage("assets/graphics/" + name + ".png")
+	if err != nil {
+		return Tile{}, err
+	}
 
 	tile := Tile{
 		X:        x,
@@ -98,119 +168,375 @@ func newTile(x int, y int, tileType string) (Tile, error) {
 	return tile, nil
 }
 
-func (level *Level) createTiles(numLevel int) {
+func (level *Level) createTiles(numLevel int) error {
 
-	tiles := make([][]Tile, gd.TilesY)
+	width, height := level.Topology.Size()
+	tiles := make([][]Tile, height)
 	for i := range tiles {
-		tiles[i] = make([]Tile, gd.TilesX)
+		tiles[i] = make([]Tile, width)
 	}
 	boxes := make([]Box, 0)
-	player, _ := NewPlayer(0, 0)
+	players := make([]Player, 0)
+	teleports := map[int][][2]int{}
 
-	for y := 0; y < gd.TilesY; y++ {
-		for x := 0; x < gd.TilesX; x++ {
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
 			switch levelsDefinition[numLevel][y][x] {
 			case '#':
 				wall, err := newTile(x, y, TileWall)
 				if err != nil {
-					panic(err)
+					return err
 				}
 				tiles[y][x] = wall
 			case '-':
 				floor, err := newTile(x, y, TileFloor)
 				if err != nil {
-					panic(err)
+					return err
 				}
 				tiles[y][x] = floor
 			case '$':
 				floor, err := newTile(x, y, TileFloor)
 				if err != nil {
-					panic(err)
+					return err
 				}
 				tiles[y][x] = floor
 
-				box, err := NewBox(x, y)
+				box, err := NewBox(x, y, 0)
 				if err != nil {
-					panic(err)
+					return err
 				}
 				boxes = append(boxes, box)
 			case '*':
 				goal, err := newTile(x, y, TileGoal)
 				if err != nil {
-					panic(err)
+					return err
 				}
 				tiles[y][x] = goal
 
-				box, err := NewBox(x, y)
+				box, err := NewBox(x, y, 0)
 				if err != nil {
-					panic(err)
+					return err
 				}
 				boxes = append(boxes, box)
 			case '.':
 				goal, err := newTile(x, y, TileGoal)
 				if err != nil {
-					panic(err)
+					return err
 				}
 				tiles[y][x] = goal
 			case '@':
 				floor, err := newTile(x, y, TileFloor)
 				if err != nil {
-					panic(err)
+					return err
 				}
 				tiles[y][x] = floor
 
-				player, err = NewPlayer(x, y)
+				player, err := NewPlayer(x, y)
 				if err != nil {
-					panic(err)
+					return err
 				}
+				players = append(players, player)
 			case '+':
 				goal, err := newTile(x, y, TileGoal)
 				if err != nil {
-					panic(err)
+					return err
 				}
 				tiles[y][x] = goal
 
-				player, err = NewPlayer(x, y)
+				player, err := NewPlayer(x, y)
 				if err != nil {
-					panic(err)
+					return err
 				}
-			default:
-				empty, err := newTile(x, y, TileEmpty)
+				players = append(players, player)
+			case iceLetter:
+				ice, err := newTile(x, y, TileIce)
 				if err != nil {
-					panic(err)
+					return err
+				}
+				ice.Image = specialTileImage(ice.Image, ice)
+				tiles[y][x] = ice
+			case 'a', 'w', 'd', 's':
+				oneWay, err := newTile(x, y, TileOneWay)
+				if err != nil {
+					return err
+				}
+				d, ok := oneWayDirection(levelsDefinition[numLevel][y][x], level.Topology)
+				if !ok {
+					return fmt.Errorf("one-way square at %d,%d points out of the grid", x+1, y+1)
+				}
+				oneWay.OneWay = d
+				oneWay.Image = specialTileImage(oneWay.Image, oneWay)
+				tiles[y][x] = oneWay
+			case '1', '2', '3', '4', '5', '6', '7', '8', '9':
+				teleport, err := newTile(x, y, TileTeleport)
+				if err != nil {
+					return err
+				}
+				teleport.Teleport = int(levelsDefinition[numLevel][y][x] - '0')
+				teleport.Image = specialTileImage(teleport.Image, teleport)
+				tiles[y][x] = teleport
+				teleports[teleport.Teleport] = append(teleports[teleport.Teleport], [2]int{x, y})
+			default:
+				if color, isBox := colorOnGoalOf(levelsDefinition[numLevel][y][x]); color != 0 {
+					goal, err := newTile(x, y, TileGoal)
+					if err != nil {
+						return err
+					}
+					goal.Color = color
+					goal.Image = tintImage(goal.Image, color)
+					tiles[y][x] = goal
+
+					if isBox {
+						box, err := NewBox(x, y, color)
+						if err != nil {
+							return err
+						}
+						boxes = append(boxes, box)
+					} else {
+						player, err := NewPlayer(x, y)
+						if err != nil {
+							return err
+						}
+						players = append(players, player)
+					}
+				} else if color, isBox := colorOf(levelsDefinition[numLevel][y][x]); color != 0 && isBox {
+					floor, err := newTile(x, y, TileFloor)
+					if err != nil {
+						return err
+					}
+					tiles[y][x] = floor
+
+					box, err := NewBox(x, y, color)
+					if err != nil {
+						return err
+					}
+					boxes = append(boxes, box)
+				} else if color != 0 {
+					goal, err := newTile(x, y, TileGoal)
+					if err != nil {
+						return err
+					}
+					goal.Color = color
+					goal.Image = tintImage(goal.Image, color)
+					tiles[y][x] = goal
+				} else {
+					empty, err := newTile(x, y, TileEmpty)
+					if err != nil {
+						return err
+					}
+					tiles[y][x] = empty
 				}
-				tiles[y][x] = empty
-
 			}
 		}
 	}
 
+	// a level without player still needs one to be drawn and moved
+	if len(players) == 0 {
+		player, err := NewPlayer(0, 0)
+		if err != nil {
+			return err
+		}
+		players = append(players, player)
+	}
+
+	// teleporters go in pairs with the same number
+	level.Teleports = map[[2]int][2]int{}
+	for number, ends := range teleports {
+		if len(ends) != 2 {
+			return fmt.Errorf("teleporter %d has %d ends instead of 2", number, len(ends))
+		}
+		level.Teleports[ends[0]] = ends[1]
+		level.Teleports[ends[1]] = ends[0]
+	}
+
 	level.Tiles = tiles
 	level.Boxes = boxes
-	level.Player = player
+	level.Players = players
+	level.ActivePlayer = 0
+
+	level.BoxGrid = make([][]int, height)
+	for y := range level.BoxGrid {
+		level.BoxGrid[y] = make([]int, width)
+		for x := range level.BoxGrid[y] {
+			level.BoxGrid[y][x] = -1
+		}
+	}
+	for i, box := range boxes {
+		level.BoxGrid[box.Y][box.X] = i
+	}
+
+	return nil
 }
 
-func (level *Level) AddMovement(x int, y int) {
-	m := Movement{PlayerLastX: x, PlayerLastY: y}
+// BoxAt returns the index of the box at a square, or -1 if there is none
+func (level *Level) BoxAt(x int, y int) int {
+	if y < 0 || y >= len(level.BoxGrid) || x < 0 || x >= len(level.BoxGrid[y]) {
+		return -1
+	}
 
-	level.LastMovements = append(level.LastMovements, m)
+	return level.BoxGrid[y][x]
+}
 
-	// only 3 last movements can be removed
-	if len(level.LastMovements) > 3 {
-		level.LastMovements = level.LastMovements[1:4]
+// TileTypeAt returns the type of the tile at a square. Squares outside the
+// grid are empty, so the player can't leave a level that is not enclosed
+func (level *Level) TileTypeAt(x int, y int) string {
+	if y < 0 || y >= len(level.Tiles) || x < 0 || x >= len(level.Tiles[y]) {
+		return TileEmpty
 	}
 
+	return level.Tiles[y][x].TileType
 }
 
-func (level *Level) AddPushMovement(playerX int, playerY int, boxIndex int, boxX int, boxY int) {
-	m := Movement{PlayerLastX: playerX, PlayerLastY: playerY, HasPush: true, BoxIndex: boxIndex, BoxLastX: boxX, BoxLastY: boxY}
+// CurrentPlayer returns the player that moves with the arrows, which is
+// the only one except in levels with several players
+func (level *Level) CurrentPlayer() *Player {
+	return &level.Players[level.ActivePlayer]
+}
 
-	level.LastMovements = append(level.LastMovements, m)
+// PlayerAt returns the index of the player at a square, or -1 if there is
+// none
+func (level *Level) PlayerAt(x int, y int) int {
+	for i, player := range level.Players {
+		if player.X == x && player.Y == y {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// SwitchPlayer makes the next player the one that moves
+func (level *Level) SwitchPlayer() {
+	level.ActivePlayer = (level.ActivePlayer + 1) % len(level.Players)
+}
 
-	// only 3 last movements can be removed
-	if len(level.LastMovements) > 3 {
-		level.LastMovements = level.LastMovements[1:4]
+// isPlayerLetter tells if a letter of a level definition has a player
+func isPlayerLetter(c byte) bool {
+	return c == '@' || c == '+' || strings.IndexByte(colorPlayerOnGoalLetters, c) != -1
+}
+
+func countPlayers(rows []string) int {
+	players := 0
+	for _, row := range rows {
+		for i := range len(row) {
+			if isPlayerLetter(row[i]) {
+				players++
+			}
+		}
 	}
+
+	return players
+}
+
+// fillFloor turns the empty squares the players can walk to into floor, as
+// level definitions in XSB format use spaces for both. It also tells if the
+// level is enclosed, which is when no player can get to its edges
+func fillFloor(rows []string, topology Topology) ([]string, bool) {
+	grid := make([][]byte, len(rows))
+	seen := map[[2]int]bool{}
+	queue := make([][2]int, 0)
+	for y, row := range rows {
+		grid[y] = []byte(row)
+		for x := range grid[y] {
+			if isPlayerLetter(grid[y][x]) {
+				seen[[2]int{x, y}] = true
+				queue = append(queue, [2]int{x, y})
+			}
+		}
+	}
+
+	if len(queue) == 0 {
+		return rows, false
+	}
+
+	enclosed := true
+	for len(queue) > 0 {
+		x, y := queue[0][0], queue[0][1]
+		queue = queue[1:]
+
+		if grid[y][x] == ' ' {
+			grid[y][x] = '-'
+		}
+
+		for _, d := range topology.Directions() {
+			nx, ny := x+d.DX, y+d.DY
+			if ny < 0 || ny >= len(grid) || nx < 0 || nx >= len(grid[ny]) {
+				// the player gets to the edge of the level
+				enclosed = false
+				continue
+			}
+			if grid[ny][nx] == '#' || seen[[2]int{nx, ny}] {
+				continue
+			}
+
+			seen[[2]int{nx, ny}] = true
+			queue = append(queue, [2]int{nx, ny})
+		}
+	}
+
+	filled := make([]string, len(grid))
+	for y := range grid {
+		filled[y] = string(grid[y])
+	}
+
+	return filled, enclosed
+}
+
+// MoveBox moves a box keeping the grid of boxes up to date
+func (level *Level) MoveBox(i int, x int, y int) {
+	box := &level.Boxes[i]
+	level.BoxGrid[box.Y][box.X] = -1
+	box.X = x
+	box.Y = y
+	level.BoxGrid[y][x] = i
+}
+
+// moves are recorded in LURD notation, uppercase for pushes, so the
+// solution of the level can be saved or replayed. In levels with several
+// players, the number of a player goes before its moves when it's not the
+// one that moved last, the first player being the one that starts
+func (level *Level) recordMove(move byte) {
+	if lastMover(level.Moves) != level.ActivePlayer {
+		number := byte('1' + level.ActivePlayer)
+		level.Moves += string(number)
+		level.History.Add(number)
+	}
+
+	level.Moves += string(move)
+	level.History.Add(move)
+}
+
+// isPlayerNumber tells if a character of the moves chooses the player that
+// makes the next moves
+func isPlayerNumber(move byte) bool {
+	return move >= '1' && move <= '0'+maxPlayers
+}
+
+// lastMover returns the index of the player that made the last of moves
+func lastMover(moves string) int {
+	for i := len(moves) - 1; i >= 0; i-- {
+		if isPlayerNumber(moves[i]) {
+			return int(moves[i] - '1')
+		}
+	}
+
+	return 0
+}
+
+func (level *Level) AddMovement(move byte, x int, y int) {
+	m := Movement{PlayerIndex: level.ActivePlayer, PlayerLastX: x, PlayerLastY: y}
+
+	level.recordMove(move)
+
+	level.LastMovements = append(level.LastMovements, m)
+}
+
+func (level *Level) AddPushMovement(move byte, playerX int, playerY int, boxIndex int, boxX int, boxY int) {
+	m := Movement{PlayerIndex: level.ActivePlayer, PlayerLastX: playerX, PlayerLastY: playerY, HasPush: true, BoxIndex: boxIndex, BoxLastX: boxX, BoxLastY: boxY}
+
+	level.recordMove(move)
+
+	level.LastMovements = append(level.LastMovements, m)
 }
 
 func (level *Level) RemoveMovement() {
@@ -221,14 +547,24 @@ func (level *Level) RemoveMovement() {
 	m := level.LastMovements[len(level.LastMovements)-1]
 	level.LastMovements = level.LastMovements[0 : len(level.LastMovements)-1]
 
-	level.Player.X = m.PlayerLastX
-	level.Player.Y = m.PlayerLastY
+	// the player that moved is the one that moves after the undo
+	level.ActivePlayer = m.PlayerIndex
+	player := level.CurrentPlayer()
+	player.X = m.PlayerLastX
+	player.Y = m.PlayerLastY
 
 	level.Steps--
+	level.Moves = level.Moves[:len(level.Moves)-1]
+	level.History.Back()
+
+	// the number of the player goes away with its first move
+	if n := len(level.Moves); n > 0 && isPlayerNumber(level.Moves[n-1]) {
+		level.Moves = level.Moves[:n-1]
+		level.History.Back()
+	}
 
 	if m.HasPush {
-		level.Boxes[m.BoxIndex].X = m.BoxLastX
-		level.Boxes[m.BoxIndex].Y = m.BoxLastY
+		level.MoveBox(m.BoxIndex, m.BoxLastX, m.BoxLastY)
 		level.Pushes--
 	}
 }
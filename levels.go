@@ -1,5 +1,55 @@
 package main
 
+// challenge budgets are the fewest moves needed to solve each level, and
+// difficulties come from the rate command
+var easyLevelsMetadata = []LevelMetadata{
+	{MoveLimit: 44, Difficulty: 74}, // Level 1
+	{MoveLimit: 17, Difficulty: 32}, // Level 2
+	{MoveLimit: 12, Difficulty: 30}, // Level 3
+	{MoveLimit: 12, Difficulty: 34}, // Level 4
+	{MoveLimit: 20, Difficulty: 41}, // Level 5
+	{MoveLimit: 18, Difficulty: 32}, // Level 6
+	{MoveLimit: 18, Difficulty: 30}, // Level 7
+	{MoveLimit: 28, Difficulty: 46}, // Level 8
+	{MoveLimit: 12, Difficulty: 30}, // Level 9
+	{MoveLimit: 22, Difficulty: 32}, // Level 10
+	{MoveLimit: 15, Difficulty: 35}, // Level 11
+	{MoveLimit: 17, Difficulty: 29}, // Level 12
+	{MoveLimit: 15, Difficulty: 32}, // Level 13
+	{MoveLimit: 23, Difficulty: 32}, // Level 14
+	{MoveLimit: 17, Difficulty: 35}, // Level 15
+	{MoveLimit: 19, Difficulty: 35}, // Level 16
+	{MoveLimit: 25, Difficulty: 57}, // Level 17
+	{MoveLimit: 28, Difficulty: 48}, // Level 18
+	{MoveLimit: 38, Difficulty: 58}, // Level 19
+	{MoveLimit: 22, Difficulty: 43}, // Level 20
+}
+
+// only level 1 was solved by the rate command. The rest are unrated: the
+// solver runs out of memory before solving them, even with 5 million nodes
+var originalLevelsMetadata = []LevelMetadata{
+	{Difficulty: 277}, // Level 1
+	{},                // Level 2
+	{},                // Level 3
+	{},                // Level 4
+	{},                // Level 5
+	{},                // Level 6
+	{},                // Level 7
+	{},                // Level 8
+	{},                // Level 9
+	{},                // Level 10
+	{},                // Level 11
+	{},                // Level 12
+	{},                // Level 13
+	{},                // Level 14
+	{},                // Level 15
+	{},                // Level 16
+	{},                // Level 17
+	{},                // Level 18
+	{},                // Level 19
+	{},                // Level 20
+}
+
 var easyLevelsDefinition = [][]string{
 	// Level 1
 	{
@@ -617,7 +667,7 @@ var originalLevelsDefinition = [][]string{
 		" ##-#--#--$-$--#...#",
 		" #--##-#-$$-$-$##..#",
 		" #-..#-#--$------#.#",
-		" #-..#-#-$$$-$$$ #.#",
+		" #-..#-#-$$$-$$$-#.#",
 		" #####-#-------#-#.#",
 		"     #-#########-#.#",
 		"     #-----------#.#",
@@ -712,7 +762,7 @@ var originalLevelsDefinition = [][]string{
 		"   ###-#$---####    ",
 		"   #--$--##$---#    ",
 		"   #--#-@-$-#-$#    ",
-		"   #--#------$ #### ",
+		"   #--#------$-#### ",
 		"   ##-####$##-----# ",
 		"   #-$#.....#-#---# ",
 		"   #--$..**.-$#-### ",
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"image/color"
+	"sort"
+)
+
+// sortLevels sets the order the levels of the pack are played in, which is
+// the order of the definition unless the profile prefers sorting them by
+// difficulty. Unrated levels go after the rated ones
+func (g *Game) sortLevels() {
+	g.Order = make([]int, len(g.Levels))
+	for i := range g.Order {
+		g.Order[i] = i
+	}
+
+	if !profile.SortByDifficulty || len(levelsMetadata) < len(g.Levels) {
+		return
+	}
+
+	sort.SliceStable(g.Order, func(i, j int) bool {
+		a, b := levelsMetadata[g.Order[i]], levelsMetadata[g.Order[j]]
+		if (a.Difficulty == 0) != (b.Difficulty == 0) {
+			return b.Difficulty == 0
+		}
+		return a.Difficulty < b.Difficulty
+	})
+}
+
+// levelPosition returns where the current level is in the play order
+func (g *Game) levelPosition() int {
+	for pos, levelNum := range g.Order {
+		if levelNum == g.CurrentLevelNum {
+			return pos
+		}
+	}
+
+	return 0
+}
+
+func (g *Game) OpenLevelSelect() {
+	g.SelectedLevel = g.levelPosition()
+	g.CurrentScene = LevelSelectScene
+}
+
+func (g *Game) SelectLevel() {
+	g.CheckSave(g.SavePosition())
+
+	g.CurrentLevelNum = g.Order[g.SelectedLevel]
+	g.CurrentLevel = &g.Levels[g.CurrentLevelNum]
+	g.RestartLevel()
+	g.ResumePosition()
+	g.CurrentScene = PlayingScene
+}
+
+func (g *Game) ToggleLevelSort() {
+	profile.SortByDifficulty = !profile.SortByDifficulty
+	g.CheckSave(saveProfile())
+
+	levelNum := g.Order[g.SelectedLevel]
+	g.sortLevels()
+	for pos, n := range g.Order {
+		if n == levelNum {
+			g.SelectedLevel = pos
+		}
+	}
+}
+
+func DrawLevelSelect(screen *ebiten.Image, g *Game) {
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(80, 40)
+	text.Draw(screen, "Select level", &text.GoTextFace{Source: mplusFaceSource, Size: 36}, op)
+
+	order := "pack order"
+	if profile.SortByDifficulty {
+		order = "difficulty"
+	}
+	op = &text.DrawOptions{}
+	op.GeoM.Translate(80, 100)
+	text.Draw(screen, "Sorted by "+order+" (S: change, Enter: play, Esc: back)", &text.GoTextFace{Source: mplusFaceSource, Size: 16}, op)
+
+	// only the levels around the selected one fit in the screen
+	const rows = 20
+	first := max(0, min(g.SelectedLevel-rows/2, len(g.Order)-rows))
+	for pos := first; pos < len(g.Order) && pos < first+rows; pos++ {
+		levelNum := g.Order[pos]
+		difficulty := "-"
+		if levelNum < len(levelsMetadata) {
+			difficulty = "unrated"
+			if levelsMetadata[levelNum].Difficulty > 0 {
+				difficulty = fmt.Sprint(levelsMetadata[levelNum].Difficulty)
+			}
+		}
+
+		op := &text.DrawOptions{}
+		op.GeoM.Translate(120, float64(160+(pos-first)*45))
+		if pos == g.SelectedLevel {
+			op.ColorScale.ScaleWithColor(color.RGBA{0xff, 0xff, 0x00, 0xff})
+		}
+		line := fmt.Sprintf("Level %3d   Difficulty %7s", levelNum+1, difficulty)
+		text.Draw(screen, line, &text.GoTextFace{Source: mplusFaceSource, Size: 24}, op)
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"bytes"
 	"embed"
+	"flag"
+	"fmt"
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/audio"
 	"github.com/hajimehoshi/ebiten/v2/audio/mp3"
@@ -10,8 +12,10 @@ import (
 	"github.com/hajimehoshi/ebiten/v2/text/v2"
 	"image"
 	"image/color"
+	"math/rand"
 	"os"
 	"strconv"
+	"time"
 )
 
 type Scene int64
@@ -22,22 +26,88 @@ const (
 	PlayingScene
 	ExcelScene
 	EndScene
+	LevelSelectScene
+	ProfilesScene
+	ErrorScene
 	QuitScene
 )
 
 const (
 	EasyMode SelectedMode = iota
 	OriginalMode
+	TimeAttackMode
+	ChallengeMode
+	RandomMode
+	DailyMode
+	ImportedMode
+	RaceMode
 	QuitMode
 )
 
+func (mode SelectedMode) String() string {
+	switch mode {
+	case EasyMode:
+		return "Easy"
+	case OriginalMode:
+		return "Original"
+	case TimeAttackMode:
+		return "Time attack"
+	case ChallengeMode:
+		return "Challenge"
+	case RandomMode:
+		return "Random"
+	case DailyMode:
+		return "Daily"
+	case ImportedMode:
+		return "Imported"
+	case RaceMode:
+		return "Race"
+	case QuitMode:
+		return "Quit"
+	}
+
+	return ""
+}
+
+// IsAvailable tells if a mode can be chosen in the cover. The imported
+// mode is only there when a pack is opened with the play command, and the
+// race mode when a race is hosted or joined with the race command
+func (mode SelectedMode) IsAvailable() bool {
+	switch mode {
+	case ImportedMode:
+		return len(importedLevelsDefinition) > 0
+	case RaceMode:
+		return race != nil
+	}
+
+	return true
+}
+
 type Game struct {
 	Levels          []Level
 	CurrentLevel    *Level
 	CurrentLevelNum int
+	Order           []int
+	SelectedLevel   int
 	CurrentScene    Scene
 	Mode            string
 	ShowHelp        bool
+	ShowReach       bool
+	Reachability    Reachability
+	TimeAttack      *TimeAttack
+	Daily           *Daily
+	Race            *Race
+	Submission      *Submission
+	Export          *Export
+	PushTarget      PushTarget
+	PendingMoves    string
+	LastMove        MoveResult
+	IsResumed       bool
+	ShowHistory     bool
+	SelectedBranch  int
+	ProfileMenu     ProfileMenu
+	Error           error
+	SaveError       error
 }
 
 type GameData struct {
@@ -46,6 +116,14 @@ type GameData struct {
 	TileSize int
 }
 
+// settings of the pack played in random mode
+const (
+	randomPackSize    = 10
+	randomLevelWidth  = 10
+	randomLevelHeight = 8
+	randomLevelBoxes  = 3
+)
+
 var gd = GameData{
 	TilesX:   20,
 	TilesY:   17,
@@ -60,6 +138,12 @@ var audioContext *audio.Context
 var stepAudio *audio.Player
 var loopAudio *audio.Player
 var levelsDefinition [][]string
+var levelsMetadata []LevelMetadata
+var levelsTopology Topology
+
+// levels of the pack opened with the play command
+var importedLevelsDefinition [][]string
+var importedLevelsTopology Topology
 var coverSelectedMode SelectedMode
 
 //go:embed all:assets
@@ -69,107 +153,247 @@ func NewGame() *Game {
 	g := &Game{}
 
 	g.CurrentScene = CoverScene
+	g.PushTarget = NewPushTarget()
 
 	return g
 }
 
 func (g *Game) Start() {
+	levelsMetadata = nil
+	levelsTopology = SquareTopology
+
 	switch coverSelectedMode {
 	case EasyMode:
 		levelsDefinition = easyLevelsDefinition
+		levelsMetadata = easyLevelsMetadata
 	case OriginalMode:
 		levelsDefinition = originalLevelsDefinition
+		levelsMetadata = originalLevelsMetadata
+	case TimeAttackMode:
+		levelsDefinition = timeAttackLevelsDefinition()
+	case ChallengeMode:
+		levelsDefinition = easyLevelsDefinition
+		levelsMetadata = easyLevelsMetadata
+	case RandomMode:
+		rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+		levels, ratings, err := GeneratePack(rng, randomPackSize, randomLevelWidth, randomLevelHeight, randomLevelBoxes)
+		if err != nil {
+			g.ShowError(err)
+			return
+		}
+		levelsDefinition = levels
+		for _, rating := range ratings {
+			levelsMetadata = append(levelsMetadata, LevelMetadata{Difficulty: rating.Difficulty()})
+		}
+	case DailyMode:
+		level, err := dailyLevelDefinition(today())
+		if err != nil {
+			g.ShowError(err)
+			return
+		}
+		levelsDefinition = [][]string{level}
+	case ImportedMode:
+		levelsDefinition = importedLevelsDefinition
+		levelsTopology = importedLevelsTopology
+	case RaceMode:
+		levelsDefinition = [][]string{race.Level}
 	}
 
 	g.Levels = g.Levels[:0]
 	for i := range levelsDefinition {
-		g.Levels = append(g.Levels, NewLevel(i))
+		level, err := NewLevel(i)
+		if err != nil {
+			g.ShowError(fmt.Errorf("level %d: %w", i+1, err))
+			return
+		}
+		g.Levels = append(g.Levels, level)
 	}
 
+	g.TimeAttack = nil
+	g.Daily = nil
+	g.Race = nil
+	g.Submission = nil
+	g.Export = nil
+	g.PushTarget = NewPushTarget()
+	g.PendingMoves = ""
+	g.LastMove = MoveResult{BoxIndex: -1}
+
 	switch coverSelectedMode {
 	case EasyMode:
 		// if file doesn't exist, levelNum will be empty
 		// and CurrentLevelNum will be 0
-		levelNum, _ := os.ReadFile("current_level_easy.dat")
+		levelNum, _ := os.ReadFile(profilePath("current_level_easy.dat"))
 		g.CurrentLevelNum, _ = strconv.Atoi(string(levelNum))
 	case OriginalMode:
 		// if file doesn't exist, levelNum will be empty
 		// and CurrentLevelNum will be 0
-		levelNum, _ := os.ReadFile("current_level_original.dat")
+		levelNum, _ := os.ReadFile(profilePath("current_level_original.dat"))
 		g.CurrentLevelNum, _ = strconv.Atoi(string(levelNum))
+	case ChallengeMode:
+		// if file doesn't exist, levelNum will be empty
+		// and CurrentLevelNum will be 0
+		levelNum, _ := os.ReadFile(profilePath("current_level_challenge.dat"))
+		g.CurrentLevelNum, _ = strconv.Atoi(string(levelNum))
+	case TimeAttackMode:
+		// a run always starts from the first level
+		g.CurrentLevelNum = 0
+		g.TimeAttack = NewTimeAttack()
+	case RandomMode:
+		// random packs are new every time, so there is no progress to load
+		g.CurrentLevelNum = 0
+	case DailyMode:
+		g.CurrentLevelNum = 0
+		g.Daily = NewDaily(today())
+	case ImportedMode:
+		// the pack can change between runs, so there is no progress to load
+		g.CurrentLevelNum = 0
+	case RaceMode:
+		g.CurrentLevelNum = 0
+		g.Race = race
 	}
 
+	// a corrupt progress file starts the pack again
+	if g.CurrentLevelNum < 0 || g.CurrentLevelNum >= len(g.Levels) {
+		g.CurrentLevelNum = 0
+	}
+
+	g.sortLevels()
+
 	loopAudio.Close()
 
 	g.CurrentLevel = &g.Levels[g.CurrentLevelNum]
+	g.ResumePosition()
 	g.CurrentScene = PlayingScene
 }
 
+// MovePlayer moves the player of the current level and lets the game react
+// to what happened
+func (g *Game) MovePlayer(d Direction) MoveResult {
+	result := g.CurrentLevel.CurrentPlayer().Move(g.CurrentLevel, d)
+	g.LastMove = result
+	g.IsResumed = false
+
+	// walking against a wall or another player is silent, but pushing a
+	// stuck box is not
+	if result.Outcome != MoveBlockedByWall && result.Outcome != MoveBlockedByPlayer {
+		stepAudio.Rewind()
+		stepAudio.Play()
+	}
+
+	return result
+}
+
 func (g *Game) RestartMode() {
+	// leaving a level half done keeps its position for the next time
+	if g.CurrentScene == PlayingScene {
+		g.CheckSave(g.SavePosition())
+	}
+
 	g.CurrentScene = CoverScene
 }
 
 func (g *Game) RestartLevel() {
+	level, err := NewLevel(g.CurrentLevelNum)
+	if err != nil {
+		g.ShowError(err)
+		return
+	}
+
 	levels := g.Levels[:g.CurrentLevelNum]
-	levels = append(levels, NewLevel(g.CurrentLevelNum))
+	levels = append(levels, level)
 	levels = append(levels, g.Levels[g.CurrentLevelNum+1:]...)
 	g.Levels = levels
 	g.ShowHelp = false
+	g.PushTarget = NewPushTarget()
+	g.PendingMoves = ""
+	g.LastMove = MoveResult{BoxIndex: -1}
+	g.IsResumed = false
+	g.ShowHistory = false
+	g.Submission = nil
+	g.Export = nil
 }
 
 func (g *Game) PreviousLevel() {
-	if g.CurrentLevelNum > 0 {
-		g.CurrentLevelNum--
+	if pos := g.levelPosition(); pos > 0 {
+		g.CheckSave(g.SavePosition())
+
+		g.CurrentLevelNum = g.Order[pos-1]
 		g.CurrentLevel = &g.Levels[g.CurrentLevelNum]
 		g.RestartLevel()
+		g.ResumePosition()
 	}
 }
 
 func (g *Game) NextLevel() {
-	if g.CurrentLevelNum < len(g.Levels)-1 {
+	// the completed level has no position to resume anymore
+	g.CheckSave(g.SavePosition())
+
+	if pos := g.levelPosition(); pos < len(g.Order)-1 {
 		g.ShowHelp = false
-		g.CurrentLevelNum++
+		g.CurrentLevelNum = g.Order[pos+1]
 		g.CurrentLevel = &g.Levels[g.CurrentLevelNum]
 		g.RestartLevel()
+		g.ResumePosition()
 
 		// save current level so we can load it later
-		data := []byte(strconv.Itoa(g.CurrentLevelNum))
-
-		switch coverSelectedMode {
-		case EasyMode:
-			err := os.WriteFile("current_level_easy.dat", data, 0777)
-			if err != nil {
-				panic(err)
-			}
-		case OriginalMode:
-			err := os.WriteFile("current_level_original.dat", data, 0777)
-			if err != nil {
-				panic(err)
-			}
-		}
+		g.CheckSave(g.saveProgress())
 	} else {
-		g.CurrentLevelNum = 0
+		g.CurrentLevelNum = g.Order[0]
 
 		// save current level so we can load it later
-		data := []byte(strconv.Itoa(g.CurrentLevelNum))
-		switch coverSelectedMode {
-		case EasyMode:
-			err := os.WriteFile("current_level_easy.dat", data, 0777)
-			if err != nil {
-				panic(err)
-			}
-		case OriginalMode:
-			err := os.WriteFile("current_level_original.dat", data, 0777)
-			if err != nil {
-				panic(err)
-			}
+		g.CheckSave(g.saveProgress())
+
+		if g.TimeAttack != nil {
+			g.CheckSave(g.TimeAttack.Finish())
 		}
 
 		g.CurrentScene = EndScene
 	}
 }
 
+// saveProgress writes the current level of the packs that keep progress
+func (g *Game) saveProgress() error {
+	data := []byte(strconv.Itoa(g.CurrentLevelNum))
+
+	switch coverSelectedMode {
+	case EasyMode:
+		return writeSaveFile(profilePath("current_level_easy.dat"), data)
+	case OriginalMode:
+		return writeSaveFile(profilePath("current_level_original.dat"), data)
+	case ChallengeMode:
+		return writeSaveFile(profilePath("current_level_challenge.dat"), data)
+	}
+
+	return nil
+}
+
+// CheckSave keeps the game running when a file can't be saved, so the
+// player only loses what was not saved. The error is shown in the screen
+// until a file is written again
+func (g *Game) CheckSave(err error) {
+	if err != nil {
+		g.SaveError = err
+	} else if saveWritten {
+		g.SaveError = nil
+	}
+	saveWritten = false
+}
+
+// ShowError stops what was being played and shows the error, from where the
+// player can go back to the cover
+func (g *Game) ShowError(err error) {
+	g.Error = err
+	g.CurrentScene = ErrorScene
+}
+
 func (g *Game) Update() error {
+	if ebiten.IsWindowBeingClosed() {
+		if g.CurrentScene == PlayingScene || g.CurrentScene == ExcelScene {
+			g.CheckSave(g.SavePosition())
+		}
+		return ebiten.Termination
+	}
+
 	switch g.CurrentScene {
 	case CoverScene:
 		if !loopAudio.IsPlaying() {
@@ -180,25 +404,70 @@ func (g *Game) Update() error {
 
 	case PlayingScene:
 		if !g.CurrentLevel.IsCompleted {
-			HandleInputPlaying(g)
+			if g.ShowHistory {
+				HandleInputHistory(g)
+			} else if g.PendingMoves != "" {
+				HandleInputPendingMoves(g)
+			} else {
+				HandleInputPlaying(g)
+			}
 
-			if !g.CurrentLevel.IsCompleted {
+			if g.ShowReach {
+				g.UpdateReachability()
+			}
+
+			g.CurrentLevel.Ticks++
+			if g.TimeAttack != nil {
+				g.TimeAttack.Ticks++
+			}
+
+			// a failed challenge has to be undone before it can be completed
+			if !g.CurrentLevel.IsCompleted && !g.CurrentLevel.IsOverBudget() {
 				g.CurrentLevel.IsCompleted = g.CurrentLevel.IsLevelCompleted()
+
+				if g.CurrentLevel.IsCompleted && g.TimeAttack != nil {
+					g.TimeAttack.Split()
+				}
+
+				if g.CurrentLevel.IsCompleted {
+					g.CheckSave(g.SaveSolution())
+				}
+
+				if g.CurrentLevel.IsCompleted && g.Daily != nil {
+					g.CheckSave(g.Daily.Finish(g.CurrentLevel))
+				}
 			}
 		} else {
 			HandleInputCompleted(g)
 		}
 
+		if g.Race != nil {
+			g.Race.Report(g.CurrentLevel)
+		}
+
 	case ExcelScene:
 		HandleInputExcel(g)
 
 	case EndScene:
 		HandleInputEnd(g)
 
+	case LevelSelectScene:
+		HandleInputLevelSelect(g)
+
+	case ProfilesScene:
+		HandleInputProfiles(g)
+
+	case ErrorScene:
+		HandleInputError(g)
+
 	case QuitScene:
 		return ebiten.Termination
 	}
 
+	if spectator != nil {
+		spectator.Publish(g.SpectatorState())
+	}
+
 	return nil
 }
 
@@ -206,24 +475,21 @@ func (g *Game) Draw(screen *ebiten.Image) {
 	switch g.CurrentScene {
 	case CoverScene:
 		screen.DrawImage(coverImage, nil)
-		op := &text.DrawOptions{}
-		op.GeoM.Translate(850, 600)
-		if coverSelectedMode == EasyMode {
-			op.ColorScale.ScaleWithColor(color.RGBA{0xff, 0xff, 0x00, 0xff})
-		}
-		text.Draw(screen, "Easy", &text.GoTextFace{Source: mplusFaceSource, Size: 42}, op)
-		op = &text.DrawOptions{}
-		op.GeoM.Translate(850, 700)
-		if coverSelectedMode == OriginalMode {
-			op.ColorScale.ScaleWithColor(color.RGBA{0xff, 0xff, 0x00, 0xff})
-		}
-		text.Draw(screen, "Original", &text.GoTextFace{Source: mplusFaceSource, Size: 42}, op)
-		op = &text.DrawOptions{}
-		op.GeoM.Translate(850, 800)
-		if coverSelectedMode == QuitMode {
-			op.ColorScale.ScaleWithColor(color.RGBA{0xff, 0xff, 0x00, 0xff})
+		DrawProfileName(screen)
+		y := 480
+		for mode := EasyMode; mode <= QuitMode; mode++ {
+			if !mode.IsAvailable() {
+				continue
+			}
+
+			op := &text.DrawOptions{}
+			op.GeoM.Translate(850, float64(y))
+			y += 80
+			if coverSelectedMode == mode {
+				op.ColorScale.ScaleWithColor(color.RGBA{0xff, 0xff, 0x00, 0xff})
+			}
+			text.Draw(screen, mode.String(), &text.GoTextFace{Source: mplusFaceSource, Size: 36}, op)
 		}
-		text.Draw(screen, "Quit", &text.GoTextFace{Source: mplusFaceSource, Size: 42}, op)
 
 	case ExcelScene:
 		op := &ebiten.DrawImageOptions{}
@@ -233,11 +499,50 @@ func (g *Game) Draw(screen *ebiten.Image) {
 	case PlayingScene:
 		g.CurrentLevel.Draw(screen, g)
 
+		if g.ShowReach {
+			g.DrawReachableSquares(screen)
+		}
+
 		for _, box := range g.CurrentLevel.Boxes {
 			box.Draw(screen, g)
 		}
 
-		g.CurrentLevel.Player.Draw(screen, g)
+		if g.ShowReach {
+			g.DrawLegalPushes(screen)
+		}
+
+		if g.LastMove.Outcome == MoveBlockedByBox {
+			g.DrawBlockingBox(screen)
+		}
+
+		g.CurrentLevel.DrawPlayers(screen, g)
+		g.DrawPushTarget(screen)
+
+		if g.TimeAttack != nil {
+			g.TimeAttack.Draw(screen, g)
+		}
+
+		if g.Daily != nil {
+			g.Daily.Draw(screen)
+		}
+
+		if g.Race != nil {
+			g.Race.Draw(screen)
+		}
+
+		if g.CurrentLevel.MoveLimit > 0 || g.CurrentLevel.PushLimit > 0 {
+			g.CurrentLevel.DrawBudget(screen)
+		}
+
+		if g.IsResumed {
+			g.DrawResumed(screen)
+		}
+
+		g.CurrentLevel.DrawBookmarks(screen)
+
+		if g.ShowHistory {
+			g.DrawHistory(screen)
+		}
 
 		if g.CurrentLevel.IsCompleted {
 			op := &text.DrawOptions{}
@@ -246,6 +551,29 @@ func (g *Game) Draw(screen *ebiten.Image) {
 			op = &text.DrawOptions{}
 			op.GeoM.Translate(420, 600)
 			text.Draw(screen, "Press space to continue...", &text.GoTextFace{Source: mplusFaceSource, Size: 24}, op)
+
+			if g.TimeAttack != nil {
+				g.TimeAttack.DrawSplit(screen, g)
+			}
+
+			if g.Daily != nil {
+				g.Daily.DrawResult(screen, 660)
+			}
+
+			if g.Race != nil {
+				g.Race.DrawResult(screen, 660)
+			}
+
+			g.DrawSubmission(screen, 760)
+			g.DrawExport(screen, 790)
+		} else if g.CurrentLevel.IsOverBudget() {
+			op := &text.DrawOptions{}
+			op.GeoM.Translate(420, 550)
+			op.ColorScale.ScaleWithColor(color.RGBA{0xff, 0x60, 0x60, 0xff})
+			text.Draw(screen, "Budget exceeded!", &text.GoTextFace{Source: mplusFaceSource, Size: 36}, op)
+			op = &text.DrawOptions{}
+			op.GeoM.Translate(420, 600)
+			text.Draw(screen, "J: undo  R: restart", &text.GoTextFace{Source: mplusFaceSource, Size: 24}, op)
 		} else if g.ShowHelp {
 			op := &text.DrawOptions{}
 			op.GeoM.Translate(700, 250)
@@ -253,9 +581,12 @@ func (g *Game) Draw(screen *ebiten.Image) {
 			op = &text.DrawOptions{}
 			op.GeoM.Translate(700, 350)
 			op.LayoutOptions.LineSpacing = 40
-			text.Draw(screen, "Arrows: move player\nJ: undo movement\nR: restart level\nZ: previous level\nX: toggle Excel\nF: toggle fullscreen\nH: toggle help", &text.GoTextFace{Source: mplusFaceSource, Size: 24}, op)
+			text.Draw(screen, "Arrows: move player\nHome/PgUp/End/PgDn: hex\nJ: undo movement\nR: restart level\nZ: previous level\nT: push box to target\nCtrl+1-9: bookmark\n1-9: go to bookmark\nU: history\nTab: switch player\nO: show reachable\nL: select level\nX: toggle Excel\nF: toggle fullscreen\nH: toggle help", &text.GoTextFace{Source: mplusFaceSource, Size: 24}, op)
 		}
 
+	case LevelSelectScene:
+		DrawLevelSelect(screen, g)
+
 	case EndScene:
 		screen.DrawImage(endImage, nil)
 		op := &text.DrawOptions{}
@@ -264,9 +595,26 @@ func (g *Game) Draw(screen *ebiten.Image) {
 		op = &text.DrawOptions{}
 		op.GeoM.Translate(150, 750)
 		text.Draw(screen, "All levels completed", &text.GoTextFace{Source: mplusFaceSource, Size: 48}, op)
+		if g.TimeAttack != nil {
+			g.TimeAttack.DrawResult(screen)
+		}
+
+		if g.Daily != nil {
+			g.Daily.DrawResult(screen, 820)
+		}
 		op = &text.DrawOptions{}
 		op.GeoM.Translate(380, 900)
 		text.Draw(screen, "Press space to continue...", &text.GoTextFace{Source: mplusFaceSource, Size: 24}, op)
+
+	case ProfilesScene:
+		DrawProfiles(screen, g)
+
+	case ErrorScene:
+		DrawError(screen, g)
+	}
+
+	if g.SaveError != nil {
+		DrawSaveError(screen, g)
 	}
 }
 
@@ -274,89 +622,122 @@ func (g *Game) Layout(outsideWidth, outsideHeight int) (screenWidth, screenHeigh
 	return gd.TileSize * gd.TilesX, gd.TileSize*gd.TilesY + 20
 }
 
-func mustLoadImage(name string) *ebiten.Image {
+func loadImage(name string) (*ebiten.Image, error) {
 	f, err := assets.Open(name)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	defer f.Close()
 
 	img, _, err := image.Decode(f)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%s: %w", name, err)
 	}
 
-	return ebiten.NewImageFromImage(img)
+	return ebiten.NewImageFromImage(img), nil
 }
 
-func mustLoadSingleAudio(name string) *audio.Player {
+func loadSingleAudio(name string) (*audio.Player, error) {
 	input, err := assets.Open(name)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	stream, err := mp3.DecodeWithoutResampling(input)
 	if err != nil {
-		panic(err)
-	}
-	singlePlayer, err := audioContext.NewPlayer(stream)
-	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%s: %w", name, err)
 	}
 
-	return singlePlayer
+	return audioContext.NewPlayer(stream)
 }
 
-func mustLoadLoopAudio(name string) *audio.Player {
+func loadLoopAudio(name string) (*audio.Player, error) {
 	input, err := assets.Open(name)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	stream, err := mp3.DecodeWithoutResampling(input)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%s: %w", name, err)
 	}
 	loop := audio.NewInfiniteLoop(stream, stream.Length())
-	loopPlayer, err := audioContext.NewPlayer(loop)
-	if err != nil {
-		panic(err)
-	}
 
-	return loopPlayer
+	return audioContext.NewPlayer(loop)
 }
 
 func main() {
+	spectate := flag.String("spectate", "", "address to serve the spectator page at, like :8080")
+	flag.Parse()
+
+	if *spectate != "" {
+		var err error
+		spectator, err = StartSpectator(*spectate)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if flag.NArg() > 0 {
+		err := runCommand(flag.Args())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	err := runGame()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// runGame loads the assets and opens the game window. Errors loading the
+// assets are returned, since the game can't even show them
+func runGame() error {
 	ebiten.SetWindowSize(800, 690)
 	ebiten.SetWindowTitle("SokoMAD")
+	ebiten.SetWindowClosingHandled(true)
 
 	ff, err := text.NewGoTextFaceSource(bytes.NewReader(fonts.PressStart2P_ttf))
 	if err != nil {
-		panic(err)
+		return err
 	}
 	mplusFaceSource = ff
 
-	coverImage = mustLoadImage("assets/graphics/cover.png")
+	coverImage, err = loadImage("assets/graphics/cover.png")
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	excelImage = mustLoadImage("assets/graphics/excel.png")
+	excelImage, err = loadImage("assets/graphics/excel.png")
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	endImage = mustLoadImage("assets/graphics/end.png")
+	endImage, err = loadImage("assets/graphics/end.png")
 	if err != nil {
-		panic(err)
+		return err
 	}
 
+	profileErr := loadProfiles()
+
 	audioContext = audio.NewContext(24_000)
-	stepAudio = mustLoadSingleAudio("assets/sounds/step.mp3")
-	loopAudio = mustLoadLoopAudio("assets/sounds/cover.mp3")
+	stepAudio, err = loadSingleAudio("assets/sounds/step.mp3")
+	if err != nil {
+		return err
+	}
 
-	g := NewGame()
-	if err := ebiten.RunGame(g); err != nil {
-		panic(err)
+	loopAudio, err = loadLoopAudio("assets/sounds/cover.mp3")
+	if err != nil {
+		return err
 	}
+
+	g := NewGame()
+	g.CheckSave(profileErr)
+
+	return ebiten.RunGame(g)
 }
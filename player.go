@@ -1,17 +1,85 @@
 package main
 
 import (
+	"fmt"
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"image/color"
 )
 
+// Direction is a step on the grid, with the letter that records it in
+// LURD notation
+type Direction struct {
+	DX   int
+	DY   int
+	Move byte
+}
+
+var (
+	DirectionLeft  = Direction{DX: -1, DY: 0, Move: 'l'}
+	DirectionUp    = Direction{DX: 0, DY: -1, Move: 'u'}
+	DirectionRight = Direction{DX: 1, DY: 0, Move: 'r'}
+	DirectionDown  = Direction{DX: 0, DY: 1, Move: 'd'}
+)
+
+// directions of the square grid in LURD order
+var Directions = []Direction{DirectionLeft, DirectionUp, DirectionRight, DirectionDown}
+
+type MoveOutcome int64
+
+const (
+	MoveWalked MoveOutcome = iota
+	MovePushed
+	MoveBlockedByWall
+	MoveBlockedByBox
+	MoveBlockedByPlayer
+)
+
+func (outcome MoveOutcome) String() string {
+	switch outcome {
+	case MoveWalked:
+		return "walked"
+	case MovePushed:
+		return "pushed"
+	case MoveBlockedByWall:
+		return "blocked by wall"
+	case MoveBlockedByBox:
+		return "blocked by box"
+	case MoveBlockedByPlayer:
+		return "blocked by player"
+	}
+
+	return ""
+}
+
+// MoveResult tells what happened when the player tried to move. BoxIndex
+// is the box pushed or blocking the push, or -1
+type MoveResult struct {
+	Outcome  MoveOutcome
+	BoxIndex int
+}
+
 type Player struct {
 	X     int
 	Y     int
 	Image *ebiten.Image
 }
 
+// PushMove returns the letter that records a push in this direction
+func (d Direction) PushMove() byte {
+	return d.Move - 'a' + 'A'
+}
+
 func NewPlayer(x int, y int) (Player, error) {
-	image := mustLoadImage("assets/graphics/player.png")
+	if headless {
+		return Player{X: x, Y: y}, nil
+	}
+
+	image, err := loadImage("assets/graphics/player.png")
+	if err != nil {
+		return Player{}, err
+	}
 
 	player := Player{
 		X:     x,
@@ -23,147 +91,72 @@ func NewPlayer(x int, y int) (Player, error) {
 
 func (player *Player) Draw(screen *ebiten.Image, g *Game) {
 	op := &ebiten.DrawImageOptions{}
-	op.GeoM.Translate(float64(player.X*gd.TileSize), float64(player.Y*gd.TileSize+(gd.TileSize/2)))
+	op.GeoM.Translate(g.CurrentLevel.Topology.Origin(player.X, player.Y))
 	screen.DrawImage(player.Image, op)
 }
 
-func (player *Player) MoveRight(g *Game) {
-	// miramos si se puede mover a la nueva casilla
-	tileType := g.CurrentLevel.Tiles[player.Y][player.X+1].TileType
-	if tileType != TileFloor && tileType != TileGoal {
-		return
-	}
-
-	// miramos si hay una caja en la casilla
-	for i, box := range g.CurrentLevel.Boxes {
-		if player.Y == box.Y && player.X+1 == box.X {
-			if box.CanMoveRight(g.CurrentLevel) {
-				g.CurrentLevel.AddPushMovement(player.X, player.Y, i, g.CurrentLevel.Boxes[i].X, g.CurrentLevel.Boxes[i].Y)
-
-				g.CurrentLevel.Boxes[i].MoveRight()
-				g.CurrentLevel.Pushes++
-
-				player.X++
-				g.CurrentLevel.Steps++
-			}
-
-			stepAudio.Rewind()
-			stepAudio.Play()
-
-			return
-		}
+// DrawPlayers draws every player of the level, marking the one that moves
+// when there are several
+func (level *Level) DrawPlayers(screen *ebiten.Image, g *Game) {
+	for _, player := range level.Players {
+		player.Draw(screen, g)
 	}
 
-	g.CurrentLevel.AddMovement(player.X, player.Y)
-
-	player.X++
-	g.CurrentLevel.Steps++
-
-	stepAudio.Rewind()
-	stepAudio.Play()
-}
-
-func (player *Player) MoveLeft(g *Game) {
-	tileType := g.CurrentLevel.Tiles[player.Y][player.X-1].TileType
-	if tileType != TileFloor && tileType != TileGoal {
+	if len(level.Players) < 2 {
 		return
 	}
 
-	// miramos si hay una caja en la casilla
-	for i, box := range g.CurrentLevel.Boxes {
-		if player.Y == box.Y && player.X-1 == box.X {
-			if box.CanMoveLeft(g.CurrentLevel) {
-				g.CurrentLevel.AddPushMovement(player.X, player.Y, i, g.CurrentLevel.Boxes[i].X, g.CurrentLevel.Boxes[i].Y)
-
-				g.CurrentLevel.Boxes[i].MoveLeft()
-				g.CurrentLevel.Pushes++
-
-				player.X--
-				g.CurrentLevel.Steps++
-			}
-
-			stepAudio.Rewind()
-			stepAudio.Play()
+	player := level.CurrentPlayer()
+	size := float32(gd.TileSize)
+	x, y := level.Topology.Origin(player.X, player.Y)
+	vector.StrokeRect(screen, float32(x), float32(y), size, size, 4, color.RGBA{0x40, 0xa0, 0xff, 0xff}, false)
 
-			return
-		}
-	}
-
-	g.CurrentLevel.AddMovement(player.X, player.Y)
-
-	player.X--
-	g.CurrentLevel.Steps++
-
-	stepAudio.Rewind()
-	stepAudio.Play()
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(420, 10)
+	current := fmt.Sprintf("Player: %d/%d", level.ActivePlayer+1, len(level.Players))
+	text.Draw(screen, current, &text.GoTextFace{Source: mplusFaceSource, Size: 16}, op)
 }
 
-func (player *Player) MoveUp(g *Game) {
-	tileType := g.CurrentLevel.Tiles[player.Y-1][player.X].TileType
-	if tileType != TileFloor && tileType != TileGoal {
-		return
-	}
+// Move moves the player one square, pushing the box in the way if it can
+// be pushed, and records the movement so it can be undone. It must be the
+// current player of the level, which is the one the movement is recorded for
+func (player *Player) Move(level *Level, d Direction) MoveResult {
+	x, y := player.X+d.DX, player.Y+d.DY
 
-	// miramos si hay una caja en la casilla
-	for i, box := range g.CurrentLevel.Boxes {
-		if player.Y-1 == box.Y && player.X == box.X {
-			if box.CanMoveUp(g.CurrentLevel) {
-				g.CurrentLevel.AddPushMovement(player.X, player.Y, i, g.CurrentLevel.Boxes[i].X, g.CurrentLevel.Boxes[i].Y)
-
-				g.CurrentLevel.Boxes[i].MoveUp()
-				g.CurrentLevel.Pushes++
-
-				player.Y--
-				g.CurrentLevel.Steps++
-			}
-
-			stepAudio.Rewind()
-			stepAudio.Play()
-
-			return
-		}
+	// miramos si se puede mover a la nueva casilla
+	if !isOpenTile(level.TileTypeAt(x, y)) || !level.CanCross(player.X, player.Y, x, y, d) {
+		return MoveResult{Outcome: MoveBlockedByWall, BoxIndex: -1}
 	}
 
-	g.CurrentLevel.AddMovement(player.X, player.Y)
-
-	player.Y--
-	g.CurrentLevel.Steps++
-
-	stepAudio.Rewind()
-	stepAudio.Play()
-}
-
-func (player *Player) MoveDown(g *Game) {
-	tileType := g.CurrentLevel.Tiles[player.Y+1][player.X].TileType
-	if tileType != TileFloor && tileType != TileGoal {
-		return
+	if level.PlayerAt(x, y) != -1 {
+		return MoveResult{Outcome: MoveBlockedByPlayer, BoxIndex: -1}
 	}
 
 	// miramos si hay una caja en la casilla
-	for i, box := range g.CurrentLevel.Boxes {
-		if player.Y+1 == box.Y && player.X == box.X {
-			if box.CanMoveDown(g.CurrentLevel) {
-				g.CurrentLevel.AddPushMovement(player.X, player.Y, i, g.CurrentLevel.Boxes[i].X, g.CurrentLevel.Boxes[i].Y)
+	if i := level.BoxAt(x, y); i != -1 {
+		box := level.Boxes[i]
+		if !box.CanMove(level, d) {
+			return MoveResult{Outcome: MoveBlockedByBox, BoxIndex: i}
+		}
 
-				g.CurrentLevel.Boxes[i].MoveDown()
-				g.CurrentLevel.Pushes++
+		// the last positions are kept, so slides and teleports are undone
+		// in a single step
+		level.AddPushMovement(d.PushMove(), player.X, player.Y, i, box.X, box.Y)
 
-				player.Y++
-				g.CurrentLevel.Steps++
-			}
+		boxX, boxY := box.Destination(level, d)
+		level.MoveBox(i, boxX, boxY)
+		level.Pushes++
 
-			stepAudio.Rewind()
-			stepAudio.Play()
+		player.X, player.Y = level.arrive(x, y)
+		level.Steps++
 
-			return
-		}
+		return MoveResult{Outcome: MovePushed, BoxIndex: i}
 	}
 
-	g.CurrentLevel.AddMovement(player.X, player.Y)
+	level.AddMovement(d.Move, player.X, player.Y)
 
-	player.Y++
-	g.CurrentLevel.Steps++
+	player.X, player.Y = level.arrive(x, y)
+	level.Steps++
 
-	stepAudio.Rewind()
-	stepAudio.Play()
+	return MoveResult{Outcome: MoveWalked, BoxIndex: -1}
 }
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Profile keeps the player records and settings that are not tied to a
+// single pack progress file, like the time attack splits or the daily levels
+type Profile struct {
+	TimeAttackBest   []int                  `json:"time_attack_best"`
+	Daily            map[string]DailyResult `json:"daily"`
+	SortByDifficulty bool                   `json:"sort_by_difficulty"`
+	Solutions        map[string]string      `json:"solutions"`
+	LeaderboardURL   string                 `json:"leaderboard_url"`
+}
+
+const profileFile = "profile.json"
+
+// every player profile is a folder inside profilesDir with its own
+// progress, positions and profile files
+const (
+	profilesDir     = "profiles"
+	lastProfileFile = "profiles/last_profile.txt"
+	maxProfileName  = 16
+)
+
+// files saved before there were profiles, which go to the first profile
+var legacyFiles = []string{
+	profileFile,
+	"current_level_easy.dat",
+	"current_level_original.dat",
+	"current_level_challenge.dat",
+	"positions_easy.json",
+	"positions_original.json",
+	"positions_challenge.json",
+}
+
+var profile Profile
+var profileName string
+
+// profilePath returns the path of a file saved in the current profile
+func profilePath(name string) string {
+	return filepath.Join(profilesDir, profileName, name)
+}
+
+// saveWritten tells if a file of the game was written since the last
+// CheckSave. Saves that have nothing to write don't tell if saving works
+var saveWritten bool
+
+// writeSaveFile writes a file of the game, keeping track of the writes
+// that worked
+func writeSaveFile(name string, data []byte) error {
+	if err := os.WriteFile(name, data, 0777); err != nil {
+		return err
+	}
+	saveWritten = true
+
+	return nil
+}
+
+func loadProfile() {
+	profile = Profile{}
+
+	// if file doesn't exist or is corrupt, the profile stays empty
+	data, err := os.ReadFile(profilePath(profileFile))
+	if err != nil {
+		return
+	}
+
+	_ = json.Unmarshal(data, &profile)
+}
+
+func saveProfile() error {
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeSaveFile(profilePath(profileFile), data)
+}
+
+// listProfiles returns the names of the profiles sorted alphabetically
+func listProfiles() []string {
+	names := make([]string, 0)
+	entries, _ := os.ReadDir(profilesDir)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// loadProfiles chooses the profile used last. The first time, a profile is
+// created with the files saved before there were profiles
+func loadProfiles() error {
+	names := listProfiles()
+	if len(names) == 0 {
+		err := createProfile("Player 1")
+		if err != nil {
+			// the game can still be played without saving
+			profileName = "Player 1"
+			return err
+		}
+		for _, name := range legacyFiles {
+			_ = os.Rename(name, filepath.Join(profilesDir, "Player 1", name))
+		}
+		names = listProfiles()
+	}
+
+	profileName = lastProfile(names)
+	loadProfile()
+
+	return nil
+}
+
+// lastProfile returns the profile used last, or the first one if it's not
+// among the names
+func lastProfile(names []string) string {
+	last, _ := os.ReadFile(lastProfileFile)
+	for _, name := range names {
+		if name == string(last) {
+			return name
+		}
+	}
+
+	return names[0]
+}
+
+// selectProfile loads a profile and remembers it for the next time
+func selectProfile(name string) error {
+	profileName = name
+	loadProfile()
+
+	return writeSaveFile(lastProfileFile, []byte(name))
+}
+
+// validProfileName checks that a name can be used as a folder name in
+// every system. The profile being renamed, if any, can keep its name with
+// other capitals
+func validProfileName(name string, renaming string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("the name is empty")
+	}
+	if len(name) > maxProfileName {
+		return fmt.Errorf("the name is longer than %d characters", maxProfileName)
+	}
+	if strings.Trim(name, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 -_") != "" {
+		return errors.New("only letters, numbers, spaces, - and _ can be used")
+	}
+
+	for _, other := range listProfiles() {
+		if other != renaming && strings.EqualFold(other, name) {
+			return fmt.Errorf("there is already a profile called %s", other)
+		}
+	}
+
+	return nil
+}
+
+func createProfile(name string) error {
+	err := validProfileName(name, "")
+	if err != nil {
+		return err
+	}
+
+	return os.MkdirAll(filepath.Join(profilesDir, name), 0777)
+}
+
+func renameProfile(name string, newName string) error {
+	err := validProfileName(newName, name)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(filepath.Join(profilesDir, name), filepath.Join(profilesDir, newName))
+	if err != nil {
+		return err
+	}
+
+	if name == profileName {
+		return selectProfile(newName)
+	}
+
+	return nil
+}
+
+// deleteProfile removes a profile with all its files. The last profile
+// can't be deleted, so there is always one to play with
+func deleteProfile(name string) error {
+	names := listProfiles()
+	if len(names) <= 1 {
+		return errors.New("the last profile can't be deleted")
+	}
+
+	err := os.RemoveAll(filepath.Join(profilesDir, name))
+	if err != nil {
+		return err
+	}
+
+	if name == profileName {
+		return selectProfile(listProfiles()[0])
+	}
+
+	return nil
+}
+
+// solutionKey names a level of the packs that keep progress in the
+// solutions of the profile, or returns an empty key for other modes
+func solutionKey(levelNum int) string {
+	switch coverSelectedMode {
+	case EasyMode, ChallengeMode:
+		return fmt.Sprintf("easy/%d", levelNum+1)
+	case OriginalMode:
+		return fmt.Sprintf("original/%d", levelNum+1)
+	}
+
+	return ""
+}
+
+// SaveSolution keeps the moves of a completed level when they are the
+// shortest solution of the profile
+func (g *Game) SaveSolution() error {
+	key := solutionKey(g.CurrentLevelNum)
+	if key == "" {
+		return nil
+	}
+
+	moves := g.CurrentLevel.Moves
+	if best, ok := profile.Solutions[key]; ok && countMoves(best) <= countMoves(moves) {
+		return nil
+	}
+
+	if profile.Solutions == nil {
+		profile.Solutions = map[string]string{}
+	}
+	profile.Solutions[key] = moves
+
+	return saveProfile()
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"image/color"
+)
+
+// ProfileMenu is the screen where profiles are chosen, created, renamed
+// and deleted
+type ProfileMenu struct {
+	Names      []string
+	Selected   int
+	IsTyping   bool
+	Renaming   string
+	Input      string
+	IsDeleting bool
+	Message    string
+}
+
+func (g *Game) OpenProfiles() {
+	g.ProfileMenu = ProfileMenu{Names: listProfiles()}
+	for i, name := range g.ProfileMenu.Names {
+		if name == profileName {
+			g.ProfileMenu.Selected = i
+		}
+	}
+	g.CurrentScene = ProfilesScene
+}
+
+// refresh reads the profiles again after a change, keeping the given one
+// selected
+func (m *ProfileMenu) refresh(selected string) {
+	m.Names = listProfiles()
+	m.Selected = 0
+	for i, name := range m.Names {
+		if name == selected {
+			m.Selected = i
+		}
+	}
+}
+
+// StartTyping asks for the name of a new profile, or the new name of the
+// selected one when renaming
+func (m *ProfileMenu) StartTyping(renaming bool) {
+	m.IsTyping = true
+	m.Input = ""
+	m.Renaming = ""
+	m.Message = ""
+	if renaming && len(m.Names) > 0 {
+		m.Renaming = m.Names[m.Selected]
+		m.Input = m.Renaming
+	}
+}
+
+func (m *ProfileMenu) FinishTyping() {
+	var err error
+	if m.Renaming == "" {
+		err = createProfile(m.Input)
+	} else {
+		err = renameProfile(m.Renaming, m.Input)
+	}
+
+	if err != nil {
+		m.Message = err.Error()
+		return
+	}
+
+	m.IsTyping = false
+	m.Message = ""
+	m.refresh(m.Input)
+}
+
+func (m *ProfileMenu) Delete() {
+	m.IsDeleting = false
+	err := deleteProfile(m.Names[m.Selected])
+	if err != nil {
+		m.Message = err.Error()
+		return
+	}
+
+	m.Message = ""
+	m.refresh(profileName)
+}
+
+func (g *Game) ChooseProfile() {
+	if len(g.ProfileMenu.Names) == 0 {
+		return
+	}
+
+	g.CheckSave(selectProfile(g.ProfileMenu.Names[g.ProfileMenu.Selected]))
+	g.CurrentScene = CoverScene
+}
+
+func DrawProfiles(screen *ebiten.Image, g *Game) {
+	m := &g.ProfileMenu
+
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(80, 40)
+	text.Draw(screen, "Profiles", &text.GoTextFace{Source: mplusFaceSource, Size: 36}, op)
+
+	help := "Enter: play  N: new  R: rename  D: delete  Esc: back"
+	switch {
+	case m.IsTyping:
+		help = "Type a name  Enter: save  Esc: cancel"
+	case m.IsDeleting:
+		help = "Delete " + m.Names[m.Selected] + " and all its progress? Y: yes  N: no"
+	}
+	op = &text.DrawOptions{}
+	op.GeoM.Translate(80, 100)
+	text.Draw(screen, help, &text.GoTextFace{Source: mplusFaceSource, Size: 16}, op)
+
+	y := 160
+	for i, name := range m.Names {
+		line := name
+		if name == profileName {
+			line += " (current)"
+		}
+		if m.IsTyping && name == m.Renaming {
+			line = m.Input + "_"
+		}
+
+		op := &text.DrawOptions{}
+		op.GeoM.Translate(120, float64(y))
+		if i == m.Selected {
+			op.ColorScale.ScaleWithColor(color.RGBA{0xff, 0xff, 0x00, 0xff})
+		}
+		text.Draw(screen, line, &text.GoTextFace{Source: mplusFaceSource, Size: 24}, op)
+		y += 45
+	}
+
+	if m.IsTyping && m.Renaming == "" {
+		op := &text.DrawOptions{}
+		op.GeoM.Translate(120, float64(y))
+		op.ColorScale.ScaleWithColor(color.RGBA{0xff, 0xff, 0x00, 0xff})
+		text.Draw(screen, m.Input+"_", &text.GoTextFace{Source: mplusFaceSource, Size: 24}, op)
+		y += 45
+	}
+
+	if m.Message != "" {
+		op := &text.DrawOptions{}
+		op.GeoM.Translate(120, float64(y+30))
+		op.ColorScale.ScaleWithColor(color.RGBA{0xff, 0x40, 0x40, 0xff})
+		text.Draw(screen, m.Message, &text.GoTextFace{Source: mplusFaceSource, Size: 16}, op)
+	}
+}
+
+// DrawProfileName shows in the cover who is playing
+func DrawProfileName(screen *ebiten.Image) {
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(850, 420)
+	text.Draw(screen, "P: "+profileName, &text.GoTextFace{Source: mplusFaceSource, Size: 20}, op)
+}
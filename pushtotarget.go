@@ -0,0 +1,214 @@
+package main
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"image/color"
+	"strings"
+)
+
+// update calls between two moves played automatically
+const pendingMoveInterval = 6
+
+// PushTarget is the box chosen to be pushed, with the keyboard cursor used
+// to choose it and its target
+type PushTarget struct {
+	IsSelecting bool
+	CursorX     int
+	CursorY     int
+	BoxIndex    int
+}
+
+func NewPushTarget() PushTarget {
+	return PushTarget{BoxIndex: -1}
+}
+
+// board copies the current position of the level, so the solver code can
+// search it without touching the level
+func (level *Level) board() *board {
+	b := &board{height: len(level.Tiles), width: len(level.Tiles[0]), topology: level.Topology}
+	b.makeSquares()
+	for y, row := range level.Tiles {
+		for x, tile := range row {
+			i := y*b.width + x
+			b.walls[i] = !isOpenTile(tile.TileType)
+			b.goals[i] = tile.TileType == TileGoal
+			b.goalColors[i] = tile.Color
+			b.ice[i] = tile.TileType == TileIce
+			if tile.TileType == TileOneWay {
+				for di, d := range b.topology.Directions() {
+					if d == tile.OneWay {
+						b.oneWay[i] = di + 1
+					}
+				}
+			}
+		}
+	}
+	for from, to := range level.Teleports {
+		b.teleports[from[1]*b.width+from[0]] = to[1]*b.width + to[0]
+	}
+
+	// the other players stand in the way like walls
+	for i, player := range level.Players {
+		if i != level.ActivePlayer {
+			b.walls[player.Y*b.width+player.X] = true
+		}
+	}
+
+	for _, box := range level.Boxes {
+		b.boxes = append(b.boxes, box.Y*b.width+box.X)
+		b.boxColors = append(b.boxColors, box.Color)
+	}
+	player := level.CurrentPlayer()
+	b.player = player.Y*b.width + player.X
+	b.findDistances()
+
+	return b
+}
+
+// pushPath finds the moves that take the box at square box to target with
+// the fewest pushes, leaving the other boxes where they are
+func (b *board) pushPath(box int, target int) (string, bool) {
+	type pushNode struct {
+		box       int
+		player    int
+		parent    int
+		direction int
+	}
+
+	others := b.occupied(b.boxes)
+	others[box] = false
+
+	nodes := []pushNode{{box: box, player: b.player, parent: -1}}
+	seen := map[[2]int]bool{}
+	specials := b.hasSpecials()
+	found := -1
+	for i := 0; i < len(nodes) && found == -1; i++ {
+		n := nodes[i]
+		if n.box == target {
+			found = i
+			break
+		}
+
+		others[n.box] = true
+		reach := b.reachable(n.player, others)
+		others[n.box] = false
+
+		// the player can be anywhere in its area, so the top-left square
+		// of the area tells positions apart, unless it can't walk back
+		area := 0
+		for area < len(reach) && !reach[area] {
+			area++
+		}
+		if specials {
+			area = n.player
+		}
+		if seen[[2]int{n.box, area}] {
+			continue
+		}
+		seen[[2]int{n.box, area}] = true
+
+		for di, d := range b.topology.Directions() {
+			from, ok := b.step(n.box, -d.DX, -d.DY)
+			if !ok || !reach[from] {
+				continue
+			}
+			others[n.box] = true
+			to, after, ok := b.pushBox(n.box, di, from, others)
+			others[n.box] = false
+			if !ok {
+				continue
+			}
+
+			nodes = append(nodes, pushNode{box: to, player: after, parent: i, direction: di})
+		}
+	}
+
+	if found == -1 {
+		return "", false
+	}
+
+	pushes := make([]pushNode, 0)
+	for i := found; nodes[i].parent != -1; i = nodes[i].parent {
+		pushes = append(pushes, nodes[i])
+	}
+
+	var moves strings.Builder
+	player := b.player
+	for i := len(pushes) - 1; i >= 0; i-- {
+		p := pushes[i]
+		d := b.topology.Directions()[p.direction]
+		pushed := nodes[p.parent].box
+		from, _ := b.step(pushed, -d.DX, -d.DY)
+
+		others[pushed] = true
+		walk, _ := b.walkPath(player, from, others)
+		others[pushed] = false
+
+		moves.WriteString(walk)
+		moves.WriteByte(d.PushMove())
+		player = p.player
+	}
+
+	return moves.String(), true
+}
+
+// PlayPendingMoves plays the moves of a push to target one by one, so they
+// can be seen and end up recorded as if they were typed
+func (g *Game) PlayPendingMoves() {
+	if g.CurrentLevel.Ticks%pendingMoveInterval != 0 {
+		return
+	}
+
+	if g.CurrentLevel.IsOverBudget() {
+		g.PendingMoves = ""
+		return
+	}
+
+	if d, ok := g.CurrentLevel.Topology.DirectionOf(g.PendingMoves[0]); ok {
+		g.MovePlayer(d)
+	}
+	g.PendingMoves = g.PendingMoves[1:]
+}
+
+// SelectSquare chooses the box to push, or the target of the chosen box
+func (g *Game) SelectSquare(x int, y int) {
+	level := g.CurrentLevel
+	if y < 0 || y >= len(level.Tiles) || x < 0 || x >= len(level.Tiles[y]) {
+		return
+	}
+
+	if i := level.BoxAt(x, y); i != -1 {
+		g.PushTarget.BoxIndex = i
+		return
+	}
+
+	if g.PushTarget.BoxIndex == -1 {
+		return
+	}
+
+	b := level.board()
+	box := level.Boxes[g.PushTarget.BoxIndex]
+	moves, ok := b.pushPath(box.Y*b.width+box.X, y*b.width+x)
+	if !ok {
+		return
+	}
+
+	g.PendingMoves = moves
+	g.PushTarget = NewPushTarget()
+}
+
+func (g *Game) DrawPushTarget(screen *ebiten.Image) {
+	size := float32(gd.TileSize)
+	topology := g.CurrentLevel.Topology
+	if g.PushTarget.BoxIndex != -1 {
+		box := g.CurrentLevel.Boxes[g.PushTarget.BoxIndex]
+		x, y := topology.Origin(box.X, box.Y)
+		vector.StrokeRect(screen, float32(x), float32(y), size, size, 4, color.RGBA{0xff, 0xff, 0x00, 0xff}, false)
+	}
+
+	if g.PushTarget.IsSelecting {
+		x, y := topology.Origin(g.PushTarget.CursorX, g.PushTarget.CursorY)
+		vector.StrokeRect(screen, float32(x)+4, float32(y)+4, size-8, size-8, 4, color.RGBA{0x00, 0xff, 0xff, 0xff}, false)
+	}
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"image/color"
+	"net"
+	"sync"
+	"time"
+)
+
+// types of the messages of a race. Joining players say hello, the host
+// answers with the level, and then everyone sends its progress. The host
+// relays the progress of each player to the others and tells who won
+const (
+	raceHello    = "hello"
+	raceLevel    = "level"
+	raceProgress = "progress"
+	raceWinner   = "winner"
+)
+
+// time a joining player has to say hello, and the host to send the level
+const raceHandshakeTimeout = 10 * time.Second
+
+// messages waiting to be sent to a player, after which progress is dropped
+const raceQueueSize = 64
+
+var errRaceDisconnected = errors.New("lost the connection to the race host")
+
+// the race opened with the race command
+var race *Race
+
+// raceMessage is what the instances of a race send each other, as one JSON
+// object per line
+type raceMessage struct {
+	Type     string        `json:"type"`
+	Name     string        `json:"name,omitempty"`
+	Level    []string      `json:"level,omitempty"`
+	Progress *RaceProgress `json:"progress,omitempty"`
+}
+
+// RaceProgress is how far a player of the race is in the level
+type RaceProgress struct {
+	Name         string `json:"name"`
+	Moves        int    `json:"moves"`
+	Pushes       int    `json:"pushes"`
+	BoxesOnGoals int    `json:"boxesOnGoals"`
+	Boxes        int    `json:"boxes"`
+	IsCompleted  bool   `json:"completed"`
+	HasLeft      bool   `json:"left"`
+}
+
+// racePeer is a connection to another instance, with the messages waiting
+// to be written to it
+type racePeer struct {
+	name     string
+	conn     net.Conn
+	outgoing chan raceMessage
+}
+
+// Race is the session of a race in the same level between instances of the
+// game. One of them hosts it and the others join by its address
+type Race struct {
+	Name   string
+	Level  []string
+	IsHost bool
+
+	mu        sync.Mutex
+	opponents []RaceProgress
+	winner    string
+	err       error
+	last      RaceProgress
+	peers     []*racePeer
+	host      *racePeer
+}
+
+func newRacePeer(conn net.Conn, name string) *racePeer {
+	p := &racePeer{name: name, conn: conn, outgoing: make(chan raceMessage, raceQueueSize)}
+	go p.write()
+
+	return p
+}
+
+func (p *racePeer) write() {
+	enc := json.NewEncoder(p.conn)
+	for msg := range p.outgoing {
+		if err := enc.Encode(msg); err != nil {
+			p.conn.Close()
+			return
+		}
+	}
+}
+
+// send queues a message without waiting, so a slow player doesn't stop
+// the game. It tells if there was room for it
+func (p *racePeer) send(msg raceMessage) bool {
+	select {
+	case p.outgoing <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// relay queues a message for a joined player. A player so far behind that
+// the queue is full is disconnected, instead of missing messages like the
+// winner
+func (p *racePeer) relay(msg raceMessage) {
+	if !p.send(msg) {
+		p.conn.Close()
+	}
+}
+
+// HostRace listens for players joining the race to play a level
+func HostRace(address string, name string, level []string) (*Race, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Race{Name: name, Level: level, IsHost: true}
+	go r.accept(listener)
+
+	return r, nil
+}
+
+// JoinRace connects to the host of a race and waits for the level
+func JoinRace(address string, name string) (*Race, error) {
+	conn, err := net.DialTimeout("tcp", address, raceHandshakeTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(raceHandshakeTimeout))
+	err = json.NewEncoder(conn).Encode(raceMessage{Type: raceHello, Name: name})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	dec := json.NewDecoder(conn)
+	var msg raceMessage
+	if err := dec.Decode(&msg); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if msg.Type != raceLevel || len(msg.Level) == 0 {
+		conn.Close()
+		return nil, fmt.Errorf("%s didn't send a level", address)
+	}
+	level, err := parseLevel(msg.Level, SquareTopology)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s sent a wrong level: %w", address, err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	// the host can change the name when another player has it
+	r := &Race{Name: msg.Name, Level: level}
+	r.host = newRacePeer(conn, "")
+	go r.listen(dec)
+
+	return r, nil
+}
+
+func (r *Race) accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go r.serve(conn)
+	}
+}
+
+// serve plays the part of the host for a joining player
+func (r *Race) serve(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(raceHandshakeTimeout))
+	dec := json.NewDecoder(conn)
+	var hello raceMessage
+	if err := dec.Decode(&hello); err != nil || hello.Type != raceHello {
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	r.mu.Lock()
+	peer := newRacePeer(conn, r.uniqueName(hello.Name))
+	peer.relay(raceMessage{Type: raceLevel, Name: peer.name, Level: r.Level})
+
+	// the new player catches up with the others. The progress is copied,
+	// since the writer reads it after the lock is released
+	host := r.last
+	host.Name = r.Name
+	peer.relay(raceMessage{Type: raceProgress, Progress: &host})
+	for _, progress := range r.opponents {
+		peer.relay(raceMessage{Type: raceProgress, Progress: &progress})
+	}
+	if r.winner != "" {
+		peer.relay(raceMessage{Type: raceWinner, Name: r.winner})
+	}
+	r.peers = append(r.peers, peer)
+	r.setProgress(RaceProgress{Name: peer.name})
+	r.mu.Unlock()
+
+	for {
+		var msg raceMessage
+		if err := dec.Decode(&msg); err != nil {
+			break
+		}
+		if msg.Type != raceProgress || msg.Progress == nil {
+			continue
+		}
+
+		progress := *msg.Progress
+		progress.Name = peer.name
+		progress.HasLeft = false
+		r.mu.Lock()
+		r.setProgress(progress)
+		r.mu.Unlock()
+	}
+
+	conn.Close()
+	r.mu.Lock()
+	for i, p := range r.peers {
+		if p == peer {
+			r.peers = append(r.peers[:i], r.peers[i+1:]...)
+			break
+		}
+	}
+	close(peer.outgoing)
+	for _, progress := range r.opponents {
+		if progress.Name == peer.name {
+			progress.HasLeft = true
+			r.setProgress(progress)
+		}
+	}
+	r.mu.Unlock()
+}
+
+// uniqueName returns the name a joining player plays with, numbering it
+// when it's taken or empty
+func (r *Race) uniqueName(name string) string {
+	if name == "" {
+		name = "Player"
+	}
+
+	taken := func(name string) bool {
+		if name == r.Name {
+			return true
+		}
+		for _, p := range r.opponents {
+			if p.Name == name && !p.HasLeft {
+				return true
+			}
+		}
+		return false
+	}
+
+	unique := name
+	for i := 2; taken(unique); i++ {
+		unique = fmt.Sprintf("%s %d", name, i)
+	}
+
+	return unique
+}
+
+// listen reads what the host sends to a joined player
+func (r *Race) listen(dec *json.Decoder) {
+	for {
+		var msg raceMessage
+		if err := dec.Decode(&msg); err != nil {
+			r.mu.Lock()
+			r.err = errRaceDisconnected
+			r.mu.Unlock()
+			return
+		}
+
+		r.mu.Lock()
+		switch msg.Type {
+		case raceProgress:
+			if msg.Progress != nil && msg.Progress.Name != r.Name {
+				r.setProgress(*msg.Progress)
+			}
+		case raceWinner:
+			r.winner = msg.Name
+		}
+		r.mu.Unlock()
+	}
+}
+
+// setProgress keeps the progress of an opponent. The host relays it to the
+// other players and names the first one to complete the level the winner.
+// The lock must be held
+func (r *Race) setProgress(progress RaceProgress) {
+	found := false
+	for i := range r.opponents {
+		if r.opponents[i].Name == progress.Name {
+			r.opponents[i] = progress
+			found = true
+		}
+	}
+	if !found {
+		r.opponents = append(r.opponents, progress)
+	}
+
+	if !r.IsHost {
+		return
+	}
+
+	for _, peer := range r.peers {
+		if peer.name != progress.Name {
+			peer.relay(raceMessage{Type: raceProgress, Progress: &progress})
+		}
+	}
+	if progress.IsCompleted {
+		r.setWinner(progress.Name)
+	}
+}
+
+// setWinner names the winner once and tells everyone. The lock must be held
+func (r *Race) setWinner(name string) {
+	if r.winner != "" {
+		return
+	}
+
+	r.winner = name
+	for _, peer := range r.peers {
+		peer.relay(raceMessage{Type: raceWinner, Name: name})
+	}
+}
+
+// Report sends the progress of the player in the level when it changed
+func (r *Race) Report(level *Level) {
+	progress := RaceProgress{
+		Name:        r.Name,
+		Moves:       level.Steps,
+		Pushes:      level.Pushes,
+		Boxes:       len(level.Boxes),
+		IsCompleted: level.IsCompleted,
+	}
+	for _, box := range level.Boxes {
+		tile := level.Tiles[box.Y][box.X]
+		if tile.TileType == TileGoal && tile.Color == box.Color {
+			progress.BoxesOnGoals++
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if progress == r.last {
+		return
+	}
+
+	if !r.IsHost {
+		// when the message doesn't fit it's sent again in the next frame
+		if r.host.send(raceMessage{Type: raceProgress, Progress: &progress}) {
+			r.last = progress
+		}
+		return
+	}
+
+	r.last = progress
+	for _, peer := range r.peers {
+		peer.relay(raceMessage{Type: raceProgress, Progress: &progress})
+	}
+	if progress.IsCompleted {
+		r.setWinner(r.Name)
+	}
+}
+
+// Winner returns the name of the first player that completed the level
+func (r *Race) Winner() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.winner
+}
+
+// Draw shows the progress of the opponents under the top bar
+func (r *Race) Draw(screen *ebiten.Image) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(230, 10)
+	role := "Race: joined as " + r.Name
+	if r.IsHost {
+		role = "Race: hosting as " + r.Name
+	}
+	text.Draw(screen, role, &text.GoTextFace{Source: mplusFaceSource, Size: 16}, op)
+
+	y := 40.0
+	if r.err != nil {
+		op := &text.DrawOptions{}
+		op.GeoM.Translate(20, y)
+		op.ColorScale.ScaleWithColor(color.RGBA{0xff, 0x60, 0x60, 0xff})
+		text.Draw(screen, r.err.Error(), &text.GoTextFace{Source: mplusFaceSource, Size: 12}, op)
+		y += 20
+	}
+
+	if r.winner != "" {
+		op := &text.DrawOptions{}
+		op.GeoM.Translate(20, y)
+		op.ColorScale.ScaleWithColor(color.RGBA{0xff, 0xff, 0x00, 0xff})
+		text.Draw(screen, r.winnerLine(), &text.GoTextFace{Source: mplusFaceSource, Size: 12}, op)
+		y += 20
+	}
+
+	for _, p := range r.opponents {
+		line := fmt.Sprintf("%s: %d moves, %d pushes, %d/%d boxes", p.Name, p.Moves, p.Pushes, p.BoxesOnGoals, p.Boxes)
+		op := &text.DrawOptions{}
+		op.GeoM.Translate(20, y)
+		switch {
+		case p.HasLeft:
+			line += " (left)"
+			op.ColorScale.ScaleWithColor(color.RGBA{0x80, 0x80, 0x80, 0xff})
+		case p.IsCompleted:
+			line += " (done)"
+			op.ColorScale.ScaleWithColor(color.RGBA{0x60, 0xff, 0x60, 0xff})
+		}
+		text.Draw(screen, line, &text.GoTextFace{Source: mplusFaceSource, Size: 12}, op)
+		y += 20
+	}
+}
+
+// DrawResult tells who won in the level complete screen
+func (r *Race) DrawResult(screen *ebiten.Image, y float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(420, y)
+	text.Draw(screen, r.winnerLine(), &text.GoTextFace{Source: mplusFaceSource, Size: 24}, op)
+}
+
+// winnerLine announces the winner. The lock must be held
+func (r *Race) winnerLine() string {
+	switch r.winner {
+	case "":
+		// a player that joined can complete the level before the host
+		// names the winner
+		return "Waiting for the result..."
+	case r.Name:
+		return "You win the race!"
+	}
+
+	return r.winner + " wins the race!"
+}
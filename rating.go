@@ -0,0 +1,140 @@
+package main
+
+import (
+	"math"
+)
+
+// Rating tells how hard a level is from the effort needed to solve it:
+// longer solutions, more changes of box or direction, positions with more
+// pushes to choose from and more squares where a box gets stuck are harder
+type Rating struct {
+	Pushes      int
+	Moves       int
+	Nodes       int
+	BoxLines    int
+	Branching   float64
+	DeadDensity float64
+	IsSolved    bool
+}
+
+// Difficulty sums up a rating in a single score to compare levels
+func (r Rating) Difficulty() int {
+	score := float64(r.Pushes) + 2*float64(r.BoxLines) + r.Branching
+	score += 10*math.Log10(float64(r.Nodes)+1) + 20*r.DeadDensity
+
+	return int(score + 0.5)
+}
+
+// rate replays a solution counting the box lines, which are the runs of
+// pushes of the same box in the same direction, and how many pushes the
+// player could choose from at each step
+func (b *board) rate(solution Solution) Rating {
+	rating := Rating{
+		Pushes:      solution.Pushes,
+		Moves:       len(solution.Moves),
+		Nodes:       solution.Nodes,
+		DeadDensity: b.deadDensity(),
+		IsSolved:    true,
+	}
+
+	boxes := append([]int(nil), b.boxes...)
+	player := b.player
+	choices := 0
+	lastBox, lastDirection := -1, Direction{}
+	for _, move := range []byte(solution.Moves) {
+		d, _ := b.topology.DirectionOf(move)
+		di := 0
+		for di < len(b.topology.Directions()) && b.topology.Directions()[di] != d {
+			di++
+		}
+
+		occupied := b.occupied(boxes)
+		next, _ := b.step(player, d.DX, d.DY)
+		pushed := false
+		for i := range boxes {
+			if boxes[i] != next {
+				continue
+			}
+
+			choices += len(b.legalPushes(player, b.sortedCopy(boxes)))
+			if i != lastBox || d != lastDirection {
+				rating.BoxLines++
+			}
+			lastBox, lastDirection = i, d
+
+			boxes[i], player, _ = b.pushBox(next, di, player, occupied)
+			pushed = true
+		}
+		if !pushed {
+			player, _ = b.walk(player, di, occupied)
+		}
+	}
+
+	if solution.Pushes > 0 {
+		rating.Branching = float64(choices) / float64(solution.Pushes)
+	}
+
+	return rating
+}
+
+// rateUnsolved estimates the rating of a level the solver gave up on, from
+// the least pushes it could need and the effort spent so far
+func (b *board) rateUnsolved(solution Solution) Rating {
+	return Rating{
+		Pushes:      b.heuristic(b.boxes),
+		Nodes:       solution.Nodes,
+		BoxLines:    len(b.boxes),
+		Branching:   float64(len(b.legalPushes(b.player, b.boxes))),
+		DeadDensity: b.deadDensity(),
+	}
+}
+
+// deadDensity is the share of the floor where a box can't be pushed,
+// averaged over the boxes when they have different colours
+func (b *board) deadDensity() float64 {
+	floor, dead := 0, 0
+	for i, wall := range b.walls {
+		if wall {
+			continue
+		}
+
+		for _, color := range b.boxColors {
+			floor++
+			if b.dead[color][i] {
+				dead++
+			}
+		}
+	}
+
+	if floor == 0 {
+		return 0
+	}
+
+	return float64(dead) / float64(floor)
+}
+
+// RateLevel solves a level and rates it, estimating the rating when the
+// solver can't finish within maxNodes
+func RateLevel(rows []string, maxNodes int) (Rating, error) {
+	if countPlayers(rows) > 1 {
+		return Rating{}, errSeveralPlayers
+	}
+
+	b := newBoard(rows)
+	solution, err := b.Solve(maxNodes)
+	switch err {
+	case nil:
+		return b.rate(solution), nil
+	case errSolverLimit:
+		return b.rateUnsolved(solution), nil
+	}
+
+	return Rating{}, err
+}
+
+func (b *board) sortedCopy(boxes []int) []int {
+	sorted := append([]int(nil), boxes...)
+	b.sortBoxes(sorted)
+
+	return sorted
+}
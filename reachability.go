@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"image/color"
+	"strings"
+)
+
+// Reachability is what the player can do from a position without pushing:
+// the squares it can walk to, and for every box, the directions in which
+// it can be pushed
+type Reachability struct {
+	Position string
+	Squares  [][]bool
+	Pushes   [][]bool
+}
+
+// position identifies where the players and the boxes are, and which
+// player moves
+func (level *Level) position() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d", level.ActivePlayer)
+	for _, player := range level.Players {
+		fmt.Fprintf(&sb, ";%d,%d", player.X, player.Y)
+	}
+	sb.WriteString("|")
+	for _, box := range level.Boxes {
+		fmt.Fprintf(&sb, ";%d,%d", box.X, box.Y)
+	}
+
+	return sb.String()
+}
+
+func (level *Level) Reachability() Reachability {
+	b := level.board()
+	occupied := b.occupied(b.boxes)
+	reach := b.reachable(b.player, occupied)
+
+	r := Reachability{Position: level.position()}
+	r.Squares = make([][]bool, b.height)
+	for y := range r.Squares {
+		r.Squares[y] = reach[y*b.width : (y+1)*b.width]
+	}
+
+	r.Pushes = make([][]bool, len(b.boxes))
+	for i, box := range b.boxes {
+		r.Pushes[i] = make([]bool, len(b.topology.Directions()))
+		for di, d := range b.topology.Directions() {
+			from, ok := b.step(box, -d.DX, -d.DY)
+			if !ok || !reach[from] {
+				continue
+			}
+			if _, _, ok := b.pushBox(box, di, from, occupied); !ok {
+				continue
+			}
+
+			r.Pushes[i][di] = true
+		}
+	}
+
+	return r
+}
+
+// UpdateReachability floods the level again only when the position changed
+func (g *Game) UpdateReachability() {
+	if g.Reachability.Position == g.CurrentLevel.position() {
+		return
+	}
+
+	g.Reachability = g.CurrentLevel.Reachability()
+}
+
+func (g *Game) DrawReachableSquares(screen *ebiten.Image) {
+	size := float32(gd.TileSize)
+	topology := g.CurrentLevel.Topology
+	for y, row := range g.Reachability.Squares {
+		for x, reachable := range row {
+			if !reachable {
+				continue
+			}
+
+			if topology == HexTopology {
+				cx, cy := topology.Center(x, y)
+				vector.DrawFilledCircle(screen, float32(cx), float32(cy), size/2, color.RGBA{0x00, 0x60, 0x00, 0x60}, false)
+			} else {
+				vx, vy := topology.Origin(x, y)
+				vector.DrawFilledRect(screen, float32(vx), float32(vy), size, size, color.RGBA{0x00, 0x60, 0x00, 0x60}, false)
+			}
+		}
+	}
+}
+
+// DrawLegalPushes marks the side of each box the player has to stand on
+// to push it
+func (g *Game) DrawLegalPushes(screen *ebiten.Image) {
+	size := float32(gd.TileSize)
+	mark := size / 8
+	topology := g.CurrentLevel.Topology
+	for i, pushes := range g.Reachability.Pushes {
+		if i >= len(g.CurrentLevel.Boxes) {
+			break
+		}
+
+		box := g.CurrentLevel.Boxes[i]
+		ox, oy := topology.Origin(box.X, box.Y)
+		x, y := float32(ox), float32(oy)
+		for di, canPush := range pushes {
+			if !canPush {
+				continue
+			}
+
+			d := topology.Directions()[di]
+			if topology == HexTopology {
+				// a dot in the side of the hexagon the player pushes from
+				cx, cy := topology.Center(box.X, box.Y)
+				fx, fy := topology.Center(box.X-d.DX, box.Y-d.DY)
+				vector.DrawFilledCircle(screen, float32(cx+(fx-cx)*0.4), float32(cy+(fy-cy)*0.4), mark, color.RGBA{0x00, 0xff, 0x00, 0xff}, false)
+				continue
+			}
+
+			switch d {
+			case DirectionLeft:
+				vector.DrawFilledRect(screen, x+size-mark, y+size/4, mark, size/2, color.RGBA{0x00, 0xff, 0x00, 0xff}, false)
+			case DirectionRight:
+				vector.DrawFilledRect(screen, x, y+size/4, mark, size/2, color.RGBA{0x00, 0xff, 0x00, 0xff}, false)
+			case DirectionUp:
+				vector.DrawFilledRect(screen, x+size/4, y+size-mark, size/2, mark, color.RGBA{0x00, 0xff, 0x00, 0xff}, false)
+			case DirectionDown:
+				vector.DrawFilledRect(screen, x+size/4, y, size/2, mark, color.RGBA{0x00, 0xff, 0x00, 0xff}, false)
+			}
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// levels of the remote API are played without a window, so they are made
+// without graphics
+var headless bool
+
+var errNoLevel = errors.New("no level loaded")
+
+// RemoteLevelRequest chooses the level to play, either a level of a pack or
+// the rows of a level in XSB, or Hexoban with Hex
+type RemoteLevelRequest struct {
+	Pack  string `json:"pack"`
+	Level int    `json:"level"`
+	XSB   string `json:"xsb"`
+	Hex   bool   `json:"hex"`
+}
+
+type RemoteMovesRequest struct {
+	Moves string `json:"moves"`
+}
+
+// RemoteMovesResponse tells what happened with each move played, and the
+// state after them. Moves after the level is completed are not played
+type RemoteMovesResponse struct {
+	Outcomes []string       `json:"outcomes"`
+	State    SpectatorState `json:"state"`
+}
+
+// Remote plays a level by the rules of the game for the requests of the
+// remote API, one request at a time. The definition of the level is kept
+// to start it again
+type Remote struct {
+	mu       sync.Mutex
+	rows     []string
+	topology Topology
+	level    *Level
+}
+
+// ServeRemote serves the remote API until the server fails
+func ServeRemote(address string) error {
+	headless = true
+	r := &Remote{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /level", r.serveLevel)
+	mux.HandleFunc("GET /state", r.serveState)
+	mux.HandleFunc("POST /moves", r.serveMoves)
+	mux.HandleFunc("POST /undo", r.serveUndo)
+	mux.HandleFunc("POST /restart", r.serveRestart)
+	mux.HandleFunc("GET /completed", r.serveCompleted)
+
+	return http.ListenAndServe(address, mux)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// levelDefinition returns the rows and the grid of the level chosen by a
+// request
+func levelDefinition(req RemoteLevelRequest) ([]string, Topology, error) {
+	if req.XSB != "" {
+		read, topology := ReadXSB, SquareTopology
+		if req.Hex {
+			read, topology = ReadHexoban, HexTopology
+		}
+
+		// the text is read like a pack, with its titles and comments
+		levels, err := read(strings.NewReader(req.XSB))
+		if err != nil {
+			return nil, topology, err
+		}
+		if len(levels) != 1 {
+			return nil, topology, fmt.Errorf("the xsb has %d levels, not one", len(levels))
+		}
+
+		return levels[0], topology, nil
+	}
+
+	if req.Hex {
+		return nil, SquareTopology, errors.New("hexoban levels must be sent in xsb")
+	}
+	levels, err := packDefinition(req.Pack)
+	if req.Level < 1 || req.Level > len(levels) {
+		if err == nil {
+			err = fmt.Errorf("no level %d in %s", req.Level, req.Pack)
+		}
+		return nil, SquareTopology, err
+	}
+
+	return levels[req.Level-1], SquareTopology, nil
+}
+
+// newLevel starts the level again, making it the only level of the game so
+// it's the one NewLevel makes
+func (r *Remote) newLevel() (*Level, error) {
+	levelsDefinition = [][]string{r.rows}
+	levelsTopology = r.topology
+
+	level, err := NewLevel(0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &level, nil
+}
+
+func (r *Remote) serveLevel(w http.ResponseWriter, req *http.Request) {
+	var levelReq RemoteLevelRequest
+	if err := json.NewDecoder(req.Body).Decode(&levelReq); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rows, topology, err := levelDefinition(levelReq)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	oldRows, oldTopology := r.rows, r.topology
+	r.rows, r.topology = rows, topology
+	level, err := r.newLevel()
+	if err != nil {
+		r.rows, r.topology = oldRows, oldTopology
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	r.level = level
+
+	writeJSON(w, http.StatusOK, r.level.SpectatorState())
+}
+
+func (r *Remote) serveState(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.level == nil {
+		writeError(w, http.StatusConflict, errNoLevel)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, r.level.SpectatorState())
+}
+
+// serveMoves plays moves in LURD notation, where the case doesn't matter
+// since the rules tell walks from pushes. A digit chooses the player that
+// makes the next moves, like in the recorded moves
+func (r *Remote) serveMoves(w http.ResponseWriter, req *http.Request) {
+	var movesReq RemoteMovesRequest
+	if err := json.NewDecoder(req.Body).Decode(&movesReq); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.level == nil {
+		writeError(w, http.StatusConflict, errNoLevel)
+		return
+	}
+
+	// the moves are checked first, so a wrong request plays none of them
+	for _, move := range []byte(movesReq.Moves) {
+		if isPlayerNumber(move) {
+			if int(move-'1') >= len(r.level.Players) {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("no player %c in the level", move))
+				return
+			}
+			continue
+		}
+		if _, ok := r.level.Topology.DirectionOf(move); !ok {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("unknown move %q", move))
+			return
+		}
+	}
+
+	resp := RemoteMovesResponse{Outcomes: []string{}}
+	for _, move := range []byte(movesReq.Moves) {
+		if r.level.IsCompleted {
+			break
+		}
+
+		if isPlayerNumber(move) {
+			r.level.ActivePlayer = int(move - '1')
+			continue
+		}
+
+		d, _ := r.level.Topology.DirectionOf(move)
+		result := r.level.CurrentPlayer().Move(r.level, d)
+		resp.Outcomes = append(resp.Outcomes, result.Outcome.String())
+		r.level.IsCompleted = r.level.IsLevelCompleted()
+	}
+	resp.State = r.level.SpectatorState()
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// serveUndo takes back the last move
+func (r *Remote) serveUndo(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.level == nil {
+		writeError(w, http.StatusConflict, errNoLevel)
+		return
+	}
+
+	r.level.RemoveMovement()
+	r.level.IsCompleted = r.level.IsLevelCompleted()
+
+	writeJSON(w, http.StatusOK, r.level.SpectatorState())
+}
+
+func (r *Remote) serveRestart(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.level == nil {
+		writeError(w, http.StatusConflict, errNoLevel)
+		return
+	}
+
+	level, err := r.newLevel()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	r.level = level
+
+	writeJSON(w, http.StatusOK, r.level.SpectatorState())
+}
+
+func (r *Remote) serveCompleted(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.level == nil {
+		writeError(w, http.StatusConflict, errNoLevel)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]bool{"completed": r.level.IsLevelCompleted()})
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"image"
+	"image/color"
+	_ "image/png"
+	"math"
+)
+
+// height of the bar over the level where the counters are written
+const renderCaptionHeight = 18
+
+// Renderer draws levels into images with the tile graphics, without the
+// game window, so they can be made from the command line. The graphics are
+// scaled to the tile size once and kept
+type Renderer struct {
+	TileSize int
+	graphics map[string]image.Image
+	scaled   map[string]*image.RGBA
+	hexMask  *image.Alpha
+}
+
+func NewRenderer(tileSize int) (*Renderer, error) {
+	r := &Renderer{TileSize: tileSize, graphics: map[string]image.Image{}, scaled: map[string]*image.RGBA{}}
+	for _, name := range []string{"box", "empty", "floor", "goal", "player", "wall"} {
+		f, err := assets.Open("assets/graphics/" + name + ".png")
+		if err != nil {
+			return nil, err
+		}
+		img, _, err := image.Decode(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s.png: %w", name, err)
+		}
+		r.graphics[name] = img
+	}
+
+	return r, nil
+}
+
+// renderBounds returns the squares of a level that are not empty, since
+// levels are padded to the size of the screen
+func renderBounds(level *Level) image.Rectangle {
+	bounds := image.Rectangle{}
+	for y, row := range level.Tiles {
+		for x, tile := range row {
+			if tile.TileType != TileEmpty {
+				bounds = bounds.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+
+	return bounds
+}
+
+// center returns where the center of a square goes in the image, counting
+// from the first square of the bounds
+func (r *Renderer) center(level *Level, bounds image.Rectangle, x int, y int) (float64, float64) {
+	size := float64(r.TileSize)
+	x, y = x-bounds.Min.X, y-bounds.Min.Y
+	if level.Topology == HexTopology {
+		radius := size / math.Sqrt(3)
+		return float64(x)*size/2 + size/2, float64(y)*1.5*radius + radius
+	}
+
+	return float64(x)*size + size/2, float64(y)*size + size/2
+}
+
+// Render draws a level, with the counters over it when caption is true
+func (r *Renderer) Render(level *Level, caption bool) *image.RGBA {
+	bounds := renderBounds(level)
+	size := float64(r.TileSize)
+	width, height := float64(bounds.Dx())*size, float64(bounds.Dy())*size
+	if level.Topology == HexTopology {
+		radius := size / math.Sqrt(3)
+		width = float64(bounds.Dx()-1)*size/2 + size
+		height = float64(bounds.Dy()-1)*1.5*radius + 2*radius
+	}
+
+	top := 0
+	if caption {
+		top = renderCaptionHeight
+	}
+	img := image.NewRGBA(image.Rect(0, 0, int(math.Ceil(width)), int(math.Ceil(height))+top))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	at := func(x int, y int) (int, int) {
+		cx, cy := r.center(level, bounds, x, y)
+		return int(cx), int(cy) + top
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			tile := level.Tiles[y][x]
+			if tile.TileType == TileEmpty && level.Topology == HexTopology {
+				continue
+			}
+			cx, cy := at(x, y)
+			r.drawTile(img, level.Topology, tile, cx, cy)
+		}
+	}
+
+	for _, box := range level.Boxes {
+		cx, cy := at(box.X, box.Y)
+		r.drawGraphic(img, r.graphic("box", box.Color, r.TileSize, r.TileSize), cx, cy, nil)
+	}
+
+	for i, player := range level.Players {
+		cx, cy := at(player.X, player.Y)
+		r.drawGraphic(img, r.graphic("player", 0, r.TileSize, r.TileSize), cx, cy, nil)
+		if len(level.Players) > 1 && i == level.ActivePlayer {
+			half := r.TileSize / 2
+			strokeRect(img, image.Rect(cx-half, cy-half, cx+half, cy+half), 3, color.RGBA{0x40, 0xa0, 0xff, 0xff})
+		}
+	}
+
+	if caption {
+		counters := fmt.Sprintf("Steps: %d  Pushes: %d", level.Steps, level.Pushes)
+		drawText(img, counters, 4, 13, color.White)
+	}
+
+	return img
+}
+
+// drawTile draws the graphic of a tile, cut as a hexagon in hexagonal
+// grids, with the mark of the special squares
+func (r *Renderer) drawTile(img *image.RGBA, topology Topology, tile Tile, cx int, cy int) {
+	name := tile.TileType
+	switch tile.TileType {
+	case TileIce, TileOneWay, TileTeleport:
+		name = TileFloor
+	}
+
+	w, h, mask := r.TileSize, r.TileSize, image.Image(nil)
+	if topology == HexTopology {
+		h = int(math.Round(2 * float64(r.TileSize) / math.Sqrt(3)))
+		mask = r.hexagon(w, h)
+	}
+
+	graphic := r.graphic(name, tile.Color, w, h)
+	if tile.TileType == TileIce {
+		graphic = tint(graphic, color.RGBA{0xa0, 0xe0, 0xff, 0xff})
+	}
+	r.drawGraphic(img, graphic, cx, cy, mask)
+
+	mark := color.RGBA{0xff, 0xa0, 0x20, 0xff}
+	size := float64(r.TileSize)
+	switch tile.TileType {
+	case TileIce:
+		for _, offset := range []float64{-0.2, 0.15} {
+			x, y := float64(cx)+offset*size, float64(cy)+offset*size
+			drawLine(img, x-size/8, y+size/8, x+size/8, y-size/8, size/20, color.White)
+		}
+	case TileOneWay:
+		length := math.Hypot(float64(tile.OneWay.DX), float64(tile.OneWay.DY))
+		dx, dy := float64(tile.OneWay.DX)/length, float64(tile.OneWay.DY)/length
+		arm := size / 3
+		tipX, tipY := float64(cx)+dx*arm, float64(cy)+dy*arm
+		width := size / 12
+		drawLine(img, float64(cx)-dx*arm, float64(cy)-dy*arm, tipX, tipY, width, mark)
+		drawLine(img, tipX, tipY, tipX-dx*arm/2-dy*arm/2, tipY-dy*arm/2+dx*arm/2, width, mark)
+		drawLine(img, tipX, tipY, tipX-dx*arm/2+dy*arm/2, tipY-dy*arm/2-dx*arm/2, width, mark)
+	case TileTeleport:
+		purple := color.RGBA{0xc0, 0x60, 0xff, 0xff}
+		drawRing(img, float64(cx), float64(cy), size/3, size/16, purple)
+		drawRing(img, float64(cx), float64(cy), size/5, size/20, purple)
+		drawText(img, fmt.Sprint(tile.Teleport), cx+r.TileSize/2-10, cy-r.TileSize/2+14, color.White)
+	}
+}
+
+// graphic returns a tile graphic scaled to a size, in one of the tile
+// colours like in the game
+func (r *Renderer) graphic(name string, colorIndex int, w int, h int) *image.RGBA {
+	key := fmt.Sprintf("%s/%d/%dx%d", name, colorIndex, w, h)
+	if scaled, ok := r.scaled[key]; ok {
+		return scaled
+	}
+
+	src := r.graphics[name]
+	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.ApproxBiLinear.Scale(scaled, scaled.Bounds(), src, src.Bounds(), draw.Src, nil)
+	if colorIndex != 0 {
+		scaled = tint(scaled, tileColors[colorIndex-1])
+	}
+	r.scaled[key] = scaled
+
+	return scaled
+}
+
+// drawGraphic draws a graphic centered on a point, through a mask if there
+// is one
+func (r *Renderer) drawGraphic(img *image.RGBA, graphic *image.RGBA, cx int, cy int, mask image.Image) {
+	w, h := graphic.Bounds().Dx(), graphic.Bounds().Dy()
+	rect := image.Rect(cx-w/2, cy-h/2, cx-w/2+w, cy-h/2+h)
+	draw.DrawMask(img, rect, graphic, image.Point{}, mask, image.Point{}, draw.Over)
+}
+
+// hexagon returns the mask of a hexagon with its corners up and down that
+// fills a rectangle
+func (r *Renderer) hexagon(w int, h int) *image.Alpha {
+	if r.hexMask != nil && r.hexMask.Bounds().Dx() == w && r.hexMask.Bounds().Dy() == h {
+		return r.hexMask
+	}
+
+	mask := image.NewAlpha(image.Rect(0, 0, w, h))
+	cx, cy := float64(w)/2, float64(h)/2
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := math.Abs(float64(x)+0.5-cx), math.Abs(float64(y)+0.5-cy)
+			// inside the vertical sides and the two slanted ones
+			if dx <= cx && dy <= cy-dx*(cy/2)/cx {
+				mask.SetAlpha(x, y, color.Alpha{0xff})
+			}
+		}
+	}
+	r.hexMask = mask
+
+	return mask
+}
+
+// tint returns a copy of an image multiplied by a colour, like the colour
+// scale of the game
+func tint(src *image.RGBA, c color.RGBA) *image.RGBA {
+	tinted := image.NewRGBA(src.Bounds())
+	for i := 0; i < len(src.Pix); i += 4 {
+		tinted.Pix[i] = uint8(uint16(src.Pix[i]) * uint16(c.R) / 0xff)
+		tinted.Pix[i+1] = uint8(uint16(src.Pix[i+1]) * uint16(c.G) / 0xff)
+		tinted.Pix[i+2] = uint8(uint16(src.Pix[i+2]) * uint16(c.B) / 0xff)
+		tinted.Pix[i+3] = src.Pix[i+3]
+	}
+
+	return tinted
+}
+
+// drawLine draws a thick line as squares along it
+func drawLine(img *image.RGBA, x0 float64, y0 float64, x1 float64, y1 float64, width float64, c color.Color) {
+	steps := int(math.Max(math.Abs(x1-x0), math.Abs(y1-y0))) + 1
+	half := int(math.Max(width/2, 1))
+	for i := 0; i <= steps; i++ {
+		x := int(x0 + (x1-x0)*float64(i)/float64(steps))
+		y := int(y0 + (y1-y0)*float64(i)/float64(steps))
+		draw.Draw(img, image.Rect(x-half, y-half, x+half, y+half), image.NewUniform(c), image.Point{}, draw.Over)
+	}
+}
+
+func drawRing(img *image.RGBA, cx float64, cy float64, radius float64, width float64, c color.RGBA) {
+	outer := int(radius + width)
+	for y := int(cy) - outer; y <= int(cy)+outer; y++ {
+		for x := int(cx) - outer; x <= int(cx)+outer; x++ {
+			if d := math.Hypot(float64(x)-cx, float64(y)-cy); math.Abs(d-radius) <= width/2 {
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+}
+
+func strokeRect(img *image.RGBA, rect image.Rectangle, width int, c color.Color) {
+	for _, side := range []image.Rectangle{
+		image.Rect(rect.Min.X, rect.Min.Y, rect.Max.X, rect.Min.Y+width),
+		image.Rect(rect.Min.X, rect.Max.Y-width, rect.Max.X, rect.Max.Y),
+		image.Rect(rect.Min.X, rect.Min.Y, rect.Min.X+width, rect.Max.Y),
+		image.Rect(rect.Max.X-width, rect.Min.Y, rect.Max.X, rect.Max.Y),
+	} {
+		draw.Draw(img, side, image.NewUniform(c), image.Point{}, draw.Src)
+	}
+}
+
+// drawText writes with a small bitmap font, from the baseline at x, y
+func drawText(img *image.RGBA, s string, x int, y int, c color.Color) {
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(c),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(s)
+}
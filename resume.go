@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"image/color"
+	"io/fs"
+	"os"
+)
+
+// SavedPosition is a level left before being completed. The moves are
+// played again to get back the boxes, the counters and the undo history
+type SavedPosition struct {
+	Moves     string         `json:"moves"`
+	Ticks     int            `json:"ticks"`
+	Bookmarks map[int]string `json:"bookmarks,omitempty"`
+}
+
+// positionsFile returns the file keeping the positions of the packs with
+// progress, or an empty name for the other modes
+func positionsFile() string {
+	switch coverSelectedMode {
+	case EasyMode:
+		return "positions_easy.json"
+	case OriginalMode:
+		return "positions_original.json"
+	case ChallengeMode:
+		return "positions_challenge.json"
+	}
+
+	return ""
+}
+
+func loadPositions(name string) map[int]SavedPosition {
+	positions := map[int]SavedPosition{}
+
+	// if file doesn't exist or is corrupt, there are no positions to resume
+	data, err := os.ReadFile(profilePath(name))
+	if err != nil {
+		return positions
+	}
+	_ = json.Unmarshal(data, &positions)
+
+	return positions
+}
+
+// SavePosition keeps the position of the current level, so it can be
+// resumed when the player comes back to it. Completed and untouched levels
+// have nothing to resume
+func (g *Game) SavePosition() error {
+	name := positionsFile()
+	if name == "" || g.CurrentLevel == nil {
+		return nil
+	}
+
+	positions := loadPositions(name)
+	level := g.CurrentLevel
+	if level.IsCompleted || (level.Moves == "" && len(level.Bookmarks) == 0) {
+		if _, ok := positions[g.CurrentLevelNum]; !ok {
+			return nil
+		}
+		delete(positions, g.CurrentLevelNum)
+	} else {
+		positions[g.CurrentLevelNum] = SavedPosition{Moves: level.Moves, Ticks: level.Ticks, Bookmarks: level.Bookmarks}
+	}
+
+	if len(positions) == 0 {
+		err := os.Remove(profilePath(name))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		saveWritten = true
+
+		return nil
+	}
+
+	data, err := json.MarshalIndent(positions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeSaveFile(profilePath(name), data)
+}
+
+// ResumePosition plays again the saved moves of the current level
+func (g *Game) ResumePosition() {
+	name := positionsFile()
+	if name == "" {
+		return
+	}
+
+	position, ok := loadPositions(name)[g.CurrentLevelNum]
+	if !ok {
+		return
+	}
+
+	level := g.CurrentLevel
+	level.Replay(position.Moves)
+	level.Ticks = position.Ticks
+	level.Bookmarks = position.Bookmarks
+	g.IsResumed = true
+}
+
+// Replay plays moves from the current position, as if they were typed
+func (level *Level) Replay(moves string) {
+	for _, move := range []byte(moves) {
+		if isPlayerNumber(move) {
+			if int(move-'1') >= len(level.Players) {
+				break
+			}
+			level.ActivePlayer = int(move - '1')
+			continue
+		}
+
+		d, ok := level.Topology.DirectionOf(move)
+		if !ok {
+			break
+		}
+
+		// moves saved from another version of the level stop where they
+		// don't fit anymore
+		if result := level.CurrentPlayer().Move(level, d); result.Outcome != MoveWalked && result.Outcome != MovePushed {
+			break
+		}
+	}
+}
+
+func (g *Game) DrawResumed(screen *ebiten.Image) {
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(20, 40)
+	op.ColorScale.ScaleWithColor(color.RGBA{0xff, 0xff, 0x00, 0xff})
+	text.Draw(screen, "Resumed saved position. R: start fresh", &text.GoTextFace{Source: mplusFaceSource, Size: 12}, op)
+}
@@ -0,0 +1,627 @@
+package main
+
+import (
+	"container/heap"
+	"errors"
+	"sort"
+	"strings"
+)
+
+var errNoSolution = errors.New("level has no solution")
+var errSolverLimit = errors.New("solver gave up before finding a solution")
+var errSeveralPlayers = errors.New("the solver can't play levels with several players")
+
+// board is a copy of a level definition without images, so the solver and
+// the generator can play thousands of positions quickly. Squares are
+// indexed as y*width+x. The colour of each box goes in boxColors, which
+// keeps the order of boxes, and distances and dead squares are kept for
+// each colour of box. One-way squares keep the index of their direction
+// plus one, and teleporters the square of the other end
+type board struct {
+	width      int
+	height     int
+	walls      []bool
+	goals      []bool
+	goalColors []int
+	ice        []bool
+	oneWay     []int
+	teleports  []int
+	dead       [][]bool
+	distances  [][]int
+	boxes      []int
+	boxColors  []int
+	player     int
+	topology   Topology
+}
+
+// Solution is a solved level in LURD notation, with the effort the solver
+// needed to find it
+type Solution struct {
+	Moves  string
+	Pushes int
+	Nodes  int
+}
+
+// push is a box pushed one square, and the state it leads to
+type push struct {
+	box       int
+	direction int
+	boxes     []int
+	player    int
+}
+
+type solverNode struct {
+	player int
+	boxes  []int
+	pushes int
+	cost   int
+	parent *solverNode
+	push   push
+}
+
+type solverQueue []*solverNode
+
+func newBoard(rows []string) *board {
+	b := &board{height: len(rows)}
+	for _, row := range rows {
+		if len(row) > b.width {
+			b.width = len(row)
+		}
+	}
+
+	b.makeSquares()
+	teleports := map[byte][]int{}
+	for y, row := range rows {
+		for x := 0; x < b.width; x++ {
+			i := y*b.width + x
+			c := byte(' ')
+			if x < len(row) {
+				c = row[x]
+			}
+
+			switch c {
+			case '-':
+			case '$':
+				b.boxes = append(b.boxes, i)
+				b.boxColors = append(b.boxColors, 0)
+			case '*':
+				b.boxes = append(b.boxes, i)
+				b.boxColors = append(b.boxColors, 0)
+				b.goals[i] = true
+			case '.':
+				b.goals[i] = true
+			case '@':
+				b.player = i
+			case '+':
+				b.player = i
+				b.goals[i] = true
+			case iceLetter:
+				b.ice[i] = true
+			default:
+				color, isBox := colorOf(c)
+				goalColor, hasBox := colorOnGoalOf(c)
+				switch {
+				case strings.IndexByte(oneWayLetters, c) != -1:
+					// the arrows are in the order of the directions
+					b.oneWay[i] = strings.IndexByte(oneWayLetters, c) + 1
+				case strings.IndexByte(teleportLetters, c) != -1:
+					teleports[c] = append(teleports[c], i)
+				case goalColor != 0:
+					b.goals[i] = true
+					b.goalColors[i] = goalColor
+					if hasBox {
+						b.boxes = append(b.boxes, i)
+						b.boxColors = append(b.boxColors, goalColor)
+					} else {
+						b.player = i
+					}
+				case color != 0 && isBox:
+					b.boxes = append(b.boxes, i)
+					b.boxColors = append(b.boxColors, color)
+				case color != 0:
+					b.goals[i] = true
+					b.goalColors[i] = color
+				default:
+					// empty squares are outside the level, so they work as walls
+					b.walls[i] = true
+				}
+			}
+		}
+	}
+
+	for _, ends := range teleports {
+		if len(ends) == 2 {
+			b.teleports[ends[0]] = ends[1]
+			b.teleports[ends[1]] = ends[0]
+		}
+	}
+
+	b.groupBoxes()
+	b.findDistances()
+
+	return b
+}
+
+// makeSquares makes the squares of a board of its size, all of them floor
+func (b *board) makeSquares() {
+	b.walls = make([]bool, b.width*b.height)
+	b.goals = make([]bool, b.width*b.height)
+	b.goalColors = make([]int, b.width*b.height)
+	b.ice = make([]bool, b.width*b.height)
+	b.oneWay = make([]int, b.width*b.height)
+	b.teleports = make([]int, b.width*b.height)
+	for i := range b.teleports {
+		b.teleports[i] = -1
+	}
+}
+
+// hasSpecials tells if the board has special floor squares. Moves over them
+// can't always be undone by moving back, so the shortcuts of the solver
+// that rely on it are left out
+func (b *board) hasSpecials() bool {
+	for i := range b.walls {
+		if b.ice[i] || b.oneWay[i] != 0 || b.teleports[i] != -1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// groupBoxes sorts the boxes by colour and then by square, so boxes of the
+// same colour are together and sortBoxes can keep them in order
+func (b *board) groupBoxes() {
+	keys := make([]int, len(b.boxes))
+	for i, box := range b.boxes {
+		keys[i] = b.boxColors[i]*len(b.walls) + box
+	}
+	sort.Ints(keys)
+
+	for i, key := range keys {
+		b.boxColors[i] = key / len(b.walls)
+		b.boxes[i] = key % len(b.walls)
+	}
+}
+
+// sortBoxes sorts the squares of each run of boxes of the same colour, so
+// positions that only differ in which of two boxes of a colour is where
+// are the same, and each box keeps the colour of its place in boxColors
+func (b *board) sortBoxes(boxes []int) {
+	for start := 0; start < len(boxes); {
+		end := start + 1
+		for end < len(boxes) && b.boxColors[end] == b.boxColors[start] {
+			end++
+		}
+		sort.Ints(boxes[start:end])
+		start = end
+	}
+}
+
+// findDistances computes, for each colour of box in the board, the fewest
+// pushes needed to take a box from each square to the nearest goal of its
+// colour, pulling boxes backwards from those goals. Squares from which a
+// box can never reach one of its goals are dead for that colour
+func (b *board) findDistances() {
+	b.distances = make([][]int, numColors)
+	b.dead = make([][]bool, numColors)
+	specials := b.hasSpecials()
+	for _, color := range b.boxColors {
+		if b.distances[color] != nil {
+			continue
+		}
+
+		// slides and teleports can't be pulled backwards, so every square
+		// is taken as next to a goal
+		if specials {
+			b.distances[color] = make([]int, len(b.walls))
+			b.dead[color] = make([]bool, len(b.walls))
+			continue
+		}
+
+		distances := make([]int, len(b.walls))
+		dead := make([]bool, len(b.walls))
+		for i := range distances {
+			distances[i] = -1
+		}
+
+		queue := make([]int, 0)
+		for i, goal := range b.goals {
+			if goal && b.goalColors[i] == color {
+				distances[i] = 0
+				queue = append(queue, i)
+			}
+		}
+
+		for len(queue) > 0 {
+			i := queue[0]
+			queue = queue[1:]
+			for _, d := range b.topology.Directions() {
+				to, ok := b.step(i, d.DX, d.DY)
+				if !ok || b.walls[to] || distances[to] != -1 {
+					continue
+				}
+				player, ok := b.step(to, d.DX, d.DY)
+				if !ok || b.walls[player] {
+					continue
+				}
+
+				distances[to] = distances[i] + 1
+				queue = append(queue, to)
+			}
+		}
+
+		for i, distance := range distances {
+			dead[i] = distance == -1
+		}
+		b.distances[color] = distances
+		b.dead[color] = dead
+	}
+}
+
+// step returns the square next to i in the given direction
+func (b *board) step(i int, dx int, dy int) (int, bool) {
+	x := i%b.width + dx
+	y := i/b.width + dy
+	if x < 0 || y < 0 || x >= b.width || y >= b.height {
+		return 0, false
+	}
+
+	return y*b.width + x, true
+}
+
+func (b *board) occupied(boxes []int) []bool {
+	occupied := make([]bool, len(b.walls))
+	for _, box := range boxes {
+		occupied[box] = true
+	}
+
+	return occupied
+}
+
+// canCross tells if the one-way squares let a move in the direction di go
+// between two squares
+func (b *board) canCross(from int, to int, di int) bool {
+	return (b.oneWay[from] == 0 || b.oneWay[from] == di+1) && (b.oneWay[to] == 0 || b.oneWay[to] == di+1)
+}
+
+// arrive returns where the player or a box moved to a square ends, which
+// is the other end of a teleporter when it's free. The square left by the
+// player is taken as not free, as the player is still there when it moves
+func (b *board) arrive(i int, occupied []bool, player int) int {
+	if t := b.teleports[i]; t != -1 && !occupied[t] && t != player {
+		return t
+	}
+
+	return i
+}
+
+// walk returns where the player ends walking from a square in the
+// direction di, if it can walk there
+func (b *board) walk(i int, di int, occupied []bool) (int, bool) {
+	d := b.topology.Directions()[di]
+	to, ok := b.step(i, d.DX, d.DY)
+	if !ok || b.walls[to] || occupied[to] || !b.canCross(i, to, di) {
+		return 0, false
+	}
+
+	return b.arrive(to, occupied, i), true
+}
+
+// pushBox returns where the box at a square ends when the player pushes it
+// from the square from in the direction di, sliding on ice and going
+// through teleporters, and where the player ends
+func (b *board) pushBox(box int, di int, from int, occupied []bool) (int, int, bool) {
+	d := b.topology.Directions()[di]
+	to, ok := b.step(box, d.DX, d.DY)
+	if !ok || b.walls[to] || occupied[to] || !b.canCross(from, box, di) || !b.canCross(box, to, di) {
+		return 0, 0, false
+	}
+
+	for b.ice[to] {
+		next, ok := b.step(to, d.DX, d.DY)
+		if !ok || b.walls[next] || occupied[next] || next == from || !b.canCross(to, next, di) {
+			break
+		}
+		to = next
+	}
+	to = b.arrive(to, occupied, from)
+
+	occupied[box] = false
+	occupied[to] = true
+	player := b.arrive(box, occupied, from)
+	occupied[to] = false
+	occupied[box] = true
+
+	return to, player, true
+}
+
+// reachable returns the squares the player can walk to without pushing
+func (b *board) reachable(player int, occupied []bool) []bool {
+	seen := make([]bool, len(b.walls))
+	seen[player] = true
+	queue := []int{player}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		for di := range b.topology.Directions() {
+			to, ok := b.walk(i, di, occupied)
+			if !ok || seen[to] {
+				continue
+			}
+			seen[to] = true
+			queue = append(queue, to)
+		}
+	}
+
+	return seen
+}
+
+// walkPath returns the moves of the shortest walk between two squares
+func (b *board) walkPath(from int, to int, occupied []bool) (string, bool) {
+	// the move that got to each square is kept, as teleporters make it
+	// impossible to tell from the squares
+	previous := make([]int, len(b.walls))
+	move := make([]byte, len(b.walls))
+	for i := range previous {
+		previous[i] = -1
+	}
+	previous[from] = from
+
+	queue := []int{from}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		if i == to {
+			break
+		}
+
+		for di, d := range b.topology.Directions() {
+			next, ok := b.walk(i, di, occupied)
+			if !ok || previous[next] != -1 {
+				continue
+			}
+			previous[next] = i
+			move[next] = d.Move
+			queue = append(queue, next)
+		}
+	}
+
+	if previous[to] == -1 {
+		return "", false
+	}
+
+	moves := make([]byte, 0)
+	for at := to; at != from; at = previous[at] {
+		moves = append(moves, move[at])
+	}
+	for l, r := 0, len(moves)-1; l < r; l, r = l+1, r-1 {
+		moves[l], moves[r] = moves[r], moves[l]
+	}
+
+	return string(moves), true
+}
+
+// isFrozen tells if the box at i is stuck in a 2x2 block of walls and boxes
+// that are not all on goals. Hexagonal grids don't have such blocks, so
+// their boxes are never found frozen
+func (b *board) isFrozen(i int, occupied []bool) bool {
+	if b.topology != SquareTopology {
+		return false
+	}
+
+	for _, corner := range [][2]int{{-1, -1}, {1, -1}, {-1, 1}, {1, 1}} {
+		square := []int{i}
+		blocked := true
+		for _, d := range [][2]int{{corner[0], 0}, {0, corner[1]}, {corner[0], corner[1]}} {
+			j, ok := b.step(i, d[0], d[1])
+			if !ok {
+				continue
+			}
+			if !b.walls[j] && !occupied[j] {
+				blocked = false
+				break
+			}
+			square = append(square, j)
+		}
+		if !blocked {
+			continue
+		}
+
+		for _, j := range square {
+			if occupied[j] && !b.goals[j] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// legalPushes returns every push the player can do from the given state,
+// leaving out the ones that end in a simple deadlock
+func (b *board) legalPushes(player int, boxes []int) []push {
+	occupied := b.occupied(boxes)
+	reach := b.reachable(player, occupied)
+
+	pushes := make([]push, 0)
+	for bi, box := range boxes {
+		for di, d := range b.topology.Directions() {
+			from, ok := b.step(box, -d.DX, -d.DY)
+			if !ok || !reach[from] {
+				continue
+			}
+			to, after, ok := b.pushBox(box, di, from, occupied)
+			if !ok || b.dead[b.boxColors[bi]][to] {
+				continue
+			}
+
+			occupied[box] = false
+			occupied[to] = true
+			frozen := b.isFrozen(to, occupied)
+			occupied[to] = false
+			occupied[box] = true
+			if frozen {
+				continue
+			}
+
+			next := make([]int, len(boxes))
+			copy(next, boxes)
+			next[bi] = to
+			b.sortBoxes(next)
+
+			pushes = append(pushes, push{box: box, direction: di, boxes: next, player: after})
+		}
+	}
+
+	return pushes
+}
+
+// normalize returns the top-left square of the player area, so states that
+// only differ in where the player walked are the same. With one-way squares
+// and teleporters the player can't always walk back, so the square is kept
+func (b *board) normalize(player int, boxes []int) int {
+	if b.hasSpecials() {
+		return player
+	}
+
+	reach := b.reachable(player, b.occupied(boxes))
+	for i, ok := range reach {
+		if ok {
+			return i
+		}
+	}
+
+	return player
+}
+
+func (b *board) stateKey(player int, boxes []int) string {
+	var sb strings.Builder
+	sb.Grow(2 * (len(boxes) + 1))
+	sb.WriteByte(byte(player >> 8))
+	sb.WriteByte(byte(player))
+	for _, box := range boxes {
+		sb.WriteByte(byte(box >> 8))
+		sb.WriteByte(byte(box))
+	}
+
+	return sb.String()
+}
+
+func (b *board) isSolved(boxes []int) bool {
+	for i, box := range boxes {
+		if !b.goals[box] || b.goalColors[box] != b.boxColors[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// heuristic is the sum of the pushes needed to take each box to its
+// nearest goal of its colour, which never overestimates the pushes left
+func (b *board) heuristic(boxes []int) int {
+	total := 0
+	for i, box := range boxes {
+		total += b.distances[b.boxColors[i]][box]
+	}
+
+	return total
+}
+
+// Solve finds a solution with the fewest pushes using A*, giving up after
+// expanding maxNodes states
+func (b *board) Solve(maxNodes int) (Solution, error) {
+	start := &solverNode{boxes: b.boxes, cost: b.heuristic(b.boxes)}
+	start.player = b.normalize(b.player, b.boxes)
+
+	queue := &solverQueue{start}
+	seen := map[string]bool{}
+	nodes := 0
+	for queue.Len() > 0 {
+		node := heap.Pop(queue).(*solverNode)
+		key := b.stateKey(node.player, node.boxes)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		nodes++
+
+		if b.isSolved(node.boxes) {
+			return Solution{Moves: b.replay(node), Pushes: node.pushes, Nodes: nodes}, nil
+		}
+		if nodes >= maxNodes {
+			return Solution{Nodes: nodes}, errSolverLimit
+		}
+
+		for _, p := range b.legalPushes(node.player, node.boxes) {
+			player := b.normalize(p.player, p.boxes)
+			if seen[b.stateKey(player, p.boxes)] {
+				continue
+			}
+
+			child := &solverNode{player: player, boxes: p.boxes, pushes: node.pushes + 1, parent: node, push: p}
+			child.cost = child.pushes + b.heuristic(p.boxes)
+			heap.Push(queue, child)
+		}
+	}
+
+	return Solution{Nodes: nodes}, errNoSolution
+}
+
+// replay turns the pushes found by the solver into player moves
+func (b *board) replay(node *solverNode) string {
+	pushes := make([]push, 0)
+	for n := node; n.parent != nil; n = n.parent {
+		pushes = append(pushes, n.push)
+	}
+
+	occupied := b.occupied(b.boxes)
+	player := b.player
+
+	var moves strings.Builder
+	for i := len(pushes) - 1; i >= 0; i-- {
+		p := pushes[i]
+		d := b.topology.Directions()[p.direction]
+		from, _ := b.step(p.box, -d.DX, -d.DY)
+		to, after, _ := b.pushBox(p.box, p.direction, from, occupied)
+
+		walk, _ := b.walkPath(player, from, occupied)
+		moves.WriteString(walk)
+		moves.WriteByte(d.PushMove())
+
+		occupied[p.box] = false
+		occupied[to] = true
+		player = after
+	}
+
+	return moves.String()
+}
+
+func (q solverQueue) Len() int {
+	return len(q)
+}
+
+func (q solverQueue) Less(i int, j int) bool {
+	// on ties, prefer the deeper node, which is closer to a solution
+	if q[i].cost == q[j].cost {
+		return q[i].pushes > q[j].pushes
+	}
+
+	return q[i].cost < q[j].cost
+}
+
+func (q solverQueue) Swap(i int, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *solverQueue) Push(x any) {
+	*q = append(*q, x.(*solverNode))
+}
+
+func (q *solverQueue) Pop() any {
+	old := *q
+	node := old[len(old)-1]
+	*q = old[:len(old)-1]
+
+	return node
+}
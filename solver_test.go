@@ -0,0 +1,89 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestSolve(t *testing.T) {
+	tests := []struct {
+		name   string
+		rows   []string
+		pushes int
+		err    error
+	}{
+		{
+			name:   "single push",
+			rows:   []string{"#####", "#@$.#", "#####"},
+			pushes: 1,
+		},
+		{
+			name:   "already solved",
+			rows:   []string{"####", "#@*#", "####"},
+			pushes: 0,
+		},
+		{
+			name:   "two boxes",
+			rows:   []string{"#######", "#-----#", "#@$-$-#", "#---..#", "#######"},
+			pushes: 5,
+		},
+		{
+			name: "goal behind a wall",
+			rows: []string{"######", "#@---#", "#-$#-#", "#--#.#", "######"},
+			err:  errNoSolution,
+		},
+		{
+			name: "box in a corner",
+			rows: []string{"#####", "#$--#", "#-@.#", "#####"},
+			err:  errNoSolution,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBoard(tt.rows)
+			solution, err := b.Solve(100_000)
+			if err != tt.err {
+				t.Fatalf("Solve() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if solution.Pushes != tt.pushes {
+				t.Errorf("Solve() = %d pushes, want %d", solution.Pushes, tt.pushes)
+			}
+			if pushes := len(strings.Map(keepUpper, solution.Moves)); pushes != solution.Pushes {
+				t.Errorf("moves %q have %d pushes, want %d", solution.Moves, pushes, solution.Pushes)
+			}
+		})
+	}
+}
+
+func TestGenerateLevel(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	for i := 0; i < 3; i++ {
+		rows, rating, err := GenerateLevel(rng, 8, 6, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rating.Pushes < 6 {
+			t.Errorf("level %d is rated with %d pushes, want at least 6", i+1, rating.Pushes)
+		}
+		if len(rows) != gd.TilesY || len(rows[0]) != gd.TilesX {
+			t.Errorf("level %d is %dx%d, want %dx%d", i+1, len(rows[0]), len(rows), gd.TilesX, gd.TilesY)
+		}
+
+		if _, err := newBoard(rows).Solve(generatorMaxNodes); err != nil {
+			t.Errorf("level %d can't be solved: %v", i+1, err)
+		}
+	}
+}
+
+// keepUpper keeps the pushes of moves in LURD notation
+func keepUpper(r rune) rune {
+	if r >= 'A' && r <= 'Z' {
+		return r
+	}
+	return -1
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"image/color"
+	"math"
+	"strings"
+)
+
+// letters of the special floor squares in level definitions. Boxes pushed
+// onto ice slide until something stops them, one-way squares can only be
+// crossed in the direction of their arrow, and the player or a box moved
+// onto a teleporter goes to the other teleporter with the same number
+const (
+	iceLetter = '~'
+
+	// one-way arrows pointing left, up, right and down, like the keys of
+	// many games
+	oneWayLetters = "awds"
+
+	teleportLetters = "123456789"
+)
+
+// isOpenTile tells if the player and the boxes can be on a tile
+func isOpenTile(tileType string) bool {
+	switch tileType {
+	case TileFloor, TileGoal, TileIce, TileOneWay, TileTeleport:
+		return true
+	}
+
+	return false
+}
+
+// oneWayDirection returns the direction of a one-way letter in a topology.
+// Hexagonal grids have no up and down, so those arrows go up right and
+// nowhere
+func oneWayDirection(c byte, topology Topology) (Direction, bool) {
+	i := strings.IndexByte(oneWayLetters, c)
+	if i == -1 {
+		return Direction{}, false
+	}
+
+	return topology.DirectionOf("lurd"[i])
+}
+
+// CanCross tells if a one-way square doesn't stop a move between two
+// squares, which must go in the direction of the arrow of both
+func (level *Level) CanCross(fromX int, fromY int, toX int, toY int, d Direction) bool {
+	for _, square := range [][2]int{{fromX, fromY}, {toX, toY}} {
+		if level.TileTypeAt(square[0], square[1]) != TileOneWay {
+			continue
+		}
+		if level.Tiles[square[1]][square[0]].OneWay != d {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isFree tells if there is neither a box nor a player in a square
+func (level *Level) isFree(x int, y int) bool {
+	return level.BoxAt(x, y) == -1 && level.PlayerAt(x, y) == -1
+}
+
+// arrive returns where the player or a box ends when moved to a square,
+// which is the other teleporter when it lands on a free teleporter
+func (level *Level) arrive(x int, y int) (int, int) {
+	if pair, ok := level.Teleports[[2]int{x, y}]; ok && level.isFree(pair[0], pair[1]) {
+		return pair[0], pair[1]
+	}
+
+	return x, y
+}
+
+// Destination returns where a box pushed in a direction stops, sliding on
+// ice and going through teleporters. The box must be able to move
+func (box *Box) Destination(level *Level, d Direction) (int, int) {
+	x, y := box.X+d.DX, box.Y+d.DY
+	for level.TileTypeAt(x, y) == TileIce {
+		nx, ny := x+d.DX, y+d.DY
+		if !isOpenTile(level.TileTypeAt(nx, ny)) || !level.isFree(nx, ny) || !level.CanCross(x, y, nx, ny, d) {
+			break
+		}
+		x, y = nx, ny
+	}
+
+	return level.arrive(x, y)
+}
+
+// specialTileImage draws the mark of a special square over the floor
+func specialTileImage(floor *ebiten.Image, tile Tile) *ebiten.Image {
+	if floor == nil {
+		return nil
+	}
+
+	w, h := floor.Bounds().Dx(), floor.Bounds().Dy()
+	image := ebiten.NewImage(w, h)
+	op := &ebiten.DrawImageOptions{}
+	cx, cy := float32(w)/2, float32(h)/2
+
+	switch tile.TileType {
+	case TileIce:
+		op.ColorScale.ScaleWithColor(color.RGBA{0xa0, 0xe0, 0xff, 0xff})
+		image.DrawImage(floor, op)
+		for _, offset := range []float32{-0.2, 0.15} {
+			vector.StrokeLine(image, cx+offset*float32(w)-8, cy+offset*float32(h)+8, cx+offset*float32(w)+8, cy+offset*float32(h)-8, 3, color.White, true)
+		}
+	case TileOneWay:
+		image.DrawImage(floor, op)
+		length := math.Hypot(float64(tile.OneWay.DX), float64(tile.OneWay.DY))
+		dx, dy := float32(float64(tile.OneWay.DX)/length), float32(float64(tile.OneWay.DY)/length)
+		size := float32(w) / 3
+		tipX, tipY := cx+dx*size, cy+dy*size
+		arrowColor := color.RGBA{0xff, 0xa0, 0x20, 0xff}
+		vector.StrokeLine(image, cx-dx*size, cy-dy*size, tipX, tipY, 5, arrowColor, true)
+		vector.StrokeLine(image, tipX, tipY, tipX-dx*size/2-dy*size/2, tipY-dy*size/2+dx*size/2, 5, arrowColor, true)
+		vector.StrokeLine(image, tipX, tipY, tipX-dx*size/2+dy*size/2, tipY-dy*size/2-dx*size/2, 5, arrowColor, true)
+	case TileTeleport:
+		image.DrawImage(floor, op)
+		vector.StrokeCircle(image, cx, cy, float32(w)/3, 4, color.RGBA{0xc0, 0x60, 0xff, 0xff}, true)
+		vector.StrokeCircle(image, cx, cy, float32(w)/5, 3, color.RGBA{0xc0, 0x60, 0xff, 0xff}, true)
+
+		// the font is only there when the game window is open
+		if mplusFaceSource != nil {
+			textOp := &text.DrawOptions{}
+			textOp.GeoM.Translate(float64(w)-18, 4)
+			text.Draw(image, fmt.Sprint(tile.Teleport), &text.GoTextFace{Source: mplusFaceSource, Size: 12}, textOp)
+		}
+	default:
+		image.DrawImage(floor, op)
+	}
+
+	return image
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// the spectator server started with the -spectate flag
+var spectator *Spectator
+
+// SpectatorState is what the spectators and the remote API see of the
+// game. Tiles uses the letters of the level definitions without boxes and
+// players, which come apart: '#' wall, '-' floor, '.' goal, ' ' outside and
+// the letters of the coloured goals and special squares
+type SpectatorState struct {
+	Scene        string           `json:"scene"`
+	Mode         string           `json:"mode,omitempty"`
+	Level        int              `json:"level,omitempty"`
+	Levels       int              `json:"levels,omitempty"`
+	Topology     string           `json:"topology,omitempty"`
+	Tiles        []string         `json:"tiles,omitempty"`
+	Players      []SpectatorPoint `json:"players,omitempty"`
+	ActivePlayer int              `json:"activePlayer"`
+	Boxes        []SpectatorBox   `json:"boxes,omitempty"`
+	Steps        int              `json:"steps"`
+	Pushes       int              `json:"pushes"`
+	Moves        string           `json:"moves"`
+	IsCompleted  bool             `json:"completed"`
+}
+
+type SpectatorPoint struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type SpectatorBox struct {
+	X     int `json:"x"`
+	Y     int `json:"y"`
+	Color int `json:"color"`
+}
+
+// Spectator streams the state of the game to the WebSocket clients every
+// time it changes
+type Spectator struct {
+	mu      sync.Mutex
+	last    []byte
+	clients map[chan []byte]bool
+}
+
+// StartSpectator serves the spectator page and the stream of the state
+func StartSpectator(address string) (*Spectator, error) {
+	s := &Spectator{clients: map[chan []byte]bool{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.servePage)
+	mux.HandleFunc("/ws", s.serveStream)
+
+	// listening before serving reports a busy address right away
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	go http.Serve(listener, mux)
+
+	return s, nil
+}
+
+func (s *Spectator) servePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	page, err := assets.ReadFile("assets/web/spectator.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
+
+// serveStream sends the last state to a new client and then every change.
+// A client that falls behind only gets the newest state
+func (s *Spectator) serveStream(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	updates := make(chan []byte, 1)
+	s.mu.Lock()
+	s.clients[updates] = true
+	if s.last != nil {
+		updates <- s.last
+	}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, updates)
+		s.mu.Unlock()
+	}()
+
+	// the page doesn't send anything, but closing and pings must be
+	// answered
+	closed := make(chan bool)
+	go func() {
+		defer close(closed)
+		for {
+			opcode, payload, err := conn.ReadFrame()
+			if err != nil {
+				return
+			}
+			switch opcode {
+			case wsClose:
+				conn.WriteFrame(wsClose, payload)
+				return
+			case wsPing:
+				conn.WriteFrame(wsPong, payload)
+			}
+		}
+	}()
+
+	for {
+		select {
+		case state := <-updates:
+			if err := conn.WriteFrame(wsText, state); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// Publish sends the state to the clients when it changed
+func (s *Spectator) Publish(state SpectatorState) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if bytes.Equal(data, s.last) {
+		return
+	}
+	s.last = data
+
+	for updates := range s.clients {
+		// an update not sent yet is replaced by the newer one
+		select {
+		case <-updates:
+		default:
+		}
+		updates <- data
+	}
+}
+
+// SpectatorState returns what the spectators see of the current scene
+func (g *Game) SpectatorState() SpectatorState {
+	switch g.CurrentScene {
+	case PlayingScene, ExcelScene:
+	case CoverScene:
+		return SpectatorState{Scene: "cover"}
+	case EndScene:
+		return SpectatorState{Scene: "end", Mode: coverSelectedMode.String()}
+	default:
+		return SpectatorState{Scene: "menu"}
+	}
+
+	// the Excel screen hides the game from the room, but not from the
+	// spectators
+	state := g.CurrentLevel.SpectatorState()
+	state.Mode = coverSelectedMode.String()
+	state.Level = g.CurrentLevelNum + 1
+	state.Levels = len(g.Levels)
+
+	return state
+}
+
+// SpectatorState returns the squares and counters of a level being played
+func (level *Level) SpectatorState() SpectatorState {
+	state := SpectatorState{
+		Scene:        "playing",
+		Topology:     "square",
+		ActivePlayer: level.ActivePlayer,
+		Steps:        level.Steps,
+		Pushes:       level.Pushes,
+		Moves:        level.Moves,
+		IsCompleted:  level.IsCompleted,
+	}
+	if level.Topology == HexTopology {
+		state.Topology = "hex"
+	}
+
+	for _, row := range level.Tiles {
+		letters := make([]byte, len(row))
+		for x, tile := range row {
+			letters[x] = tile.Letter(level.Topology)
+		}
+		state.Tiles = append(state.Tiles, string(letters))
+	}
+
+	for _, player := range level.Players {
+		state.Players = append(state.Players, SpectatorPoint{X: player.X, Y: player.Y})
+	}
+	for _, box := range level.Boxes {
+		state.Boxes = append(state.Boxes, SpectatorBox{X: box.X, Y: box.Y, Color: box.Color})
+	}
+
+	return state
+}
+
+// Letter returns the letter of a tile in the level definitions, leaving out
+// what stands on it
+func (tile Tile) Letter(topology Topology) byte {
+	switch tile.TileType {
+	case TileWall:
+		return '#'
+	case TileFloor:
+		return '-'
+	case TileGoal:
+		if tile.Color != 0 {
+			return colorGoalLetters[tile.Color-1]
+		}
+		return '.'
+	case TileIce:
+		return iceLetter
+	case TileOneWay:
+		for i := range oneWayLetters {
+			if d, ok := oneWayDirection(oneWayLetters[i], topology); ok && d == tile.OneWay {
+				return oneWayLetters[i]
+			}
+		}
+	case TileTeleport:
+		return teleportLetters[tile.Teleport-1]
+	}
+
+	return ' '
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"image/color"
+)
+
+// levels of the easy pack played in a time attack run
+var timeAttackLevels = []int{0, 1, 2, 3, 4}
+
+// TimeAttack keeps the total clock of a run and the time it took to
+// complete each level, counted from the start of the run
+type TimeAttack struct {
+	Ticks    int
+	Splits   []int
+	Best     []int
+	IsRecord bool
+}
+
+func NewTimeAttack() *TimeAttack {
+	ta := &TimeAttack{}
+
+	// a personal best from a different set of levels can't be compared
+	if len(profile.TimeAttackBest) == len(timeAttackLevels) {
+		ta.Best = profile.TimeAttackBest
+	}
+
+	return ta
+}
+
+func timeAttackLevelsDefinition() [][]string {
+	definition := make([][]string, 0, len(timeAttackLevels))
+	for _, i := range timeAttackLevels {
+		definition = append(definition, easyLevelsDefinition[i])
+	}
+
+	return definition
+}
+
+func (ta *TimeAttack) Split() {
+	ta.Splits = append(ta.Splits, ta.Ticks)
+}
+
+// Delta returns the difference with the personal best split of the level,
+// if there is one
+func (ta *TimeAttack) Delta(levelNum int) (int, bool) {
+	if levelNum >= len(ta.Best) {
+		return 0, false
+	}
+
+	return ta.Ticks - ta.Best[levelNum], true
+}
+
+// Finish saves the splits in the profile when the run beats the personal best
+func (ta *TimeAttack) Finish() error {
+	if len(ta.Best) > 0 && ta.Ticks >= ta.Best[len(ta.Best)-1] {
+		return nil
+	}
+
+	ta.IsRecord = true
+	profile.TimeAttackBest = ta.Splits
+
+	return saveProfile()
+}
+
+func (ta *TimeAttack) Draw(screen *ebiten.Image, g *Game) {
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(230, 10)
+	run := "Run: " + formatTicks(ta.Ticks)
+	if delta, ok := ta.Delta(g.CurrentLevelNum); ok {
+		run += " " + formatTicksDelta(delta)
+		if delta > 0 {
+			op.ColorScale.ScaleWithColor(color.RGBA{0xff, 0x60, 0x60, 0xff})
+		} else {
+			op.ColorScale.ScaleWithColor(color.RGBA{0x60, 0xff, 0x60, 0xff})
+		}
+	}
+	text.Draw(screen, run, &text.GoTextFace{Source: mplusFaceSource, Size: 16}, op)
+}
+
+func (ta *TimeAttack) DrawSplit(screen *ebiten.Image, g *Game) {
+	split := "Split: " + formatTicks(ta.Ticks)
+	if delta, ok := ta.Delta(g.CurrentLevelNum); ok {
+		split += fmt.Sprintf(" (%s)", formatTicksDelta(delta))
+	}
+
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(420, 650)
+	text.Draw(screen, split, &text.GoTextFace{Source: mplusFaceSource, Size: 24}, op)
+}
+
+func (ta *TimeAttack) DrawResult(screen *ebiten.Image) {
+	result := "Time: " + formatTicks(ta.Ticks)
+	if ta.IsRecord {
+		result += "  New record!"
+	} else {
+		result += "  Best: " + formatTicks(ta.Best[len(ta.Best)-1])
+	}
+
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(150, 830)
+	text.Draw(screen, result, &text.GoTextFace{Source: mplusFaceSource, Size: 24}, op)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// timers count Update calls, so they stop by themselves when the
+// game is not in the playing scene
+func formatTicks(ticks int) string {
+	tps := ebiten.TPS()
+	seconds := ticks / tps
+	hundredths := (ticks % tps) * 100 / tps
+
+	return fmt.Sprintf("%02d:%02d.%02d", seconds/60, seconds%60, hundredths)
+}
+
+func formatTicksDelta(ticks int) string {
+	if ticks < 0 {
+		return "-" + formatTicks(-ticks)
+	}
+
+	return "+" + formatTicks(ticks)
+}
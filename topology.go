@@ -0,0 +1,195 @@
+package main
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"math"
+)
+
+// Topology is the shape of the grid of a level, which tells the directions
+// the player can move in and where each square is drawn
+type Topology int64
+
+const (
+	SquareTopology Topology = iota
+	HexTopology
+)
+
+// hexagonal grids use doubled coordinates: squares of a row are two
+// columns apart and the next row is shifted one column, so the six
+// neighbours of a square are always at the same offsets
+var (
+	DirectionHexLeft      = Direction{DX: -2, DY: 0, Move: 'l'}
+	DirectionHexRight     = Direction{DX: 2, DY: 0, Move: 'r'}
+	DirectionHexUpLeft    = Direction{DX: -1, DY: -1, Move: 'y'}
+	DirectionHexUpRight   = Direction{DX: 1, DY: -1, Move: 'u'}
+	DirectionHexDownLeft  = Direction{DX: -1, DY: 1, Move: 'b'}
+	DirectionHexDownRight = Direction{DX: 1, DY: 1, Move: 'n'}
+)
+
+var HexDirections = []Direction{DirectionHexLeft, DirectionHexRight, DirectionHexUpLeft, DirectionHexUpRight, DirectionHexDownLeft, DirectionHexDownRight}
+
+// DirectionKey is a key that moves the player in a direction
+type DirectionKey struct {
+	Key       ebiten.Key
+	Direction Direction
+}
+
+var squareKeys = []DirectionKey{
+	{ebiten.KeyDown, DirectionDown},
+	{ebiten.KeyUp, DirectionUp},
+	{ebiten.KeyLeft, DirectionLeft},
+	{ebiten.KeyRight, DirectionRight},
+}
+
+// the diagonals of the hexagonal grid are in the corners of the numeric
+// keypad, which are also the keys around the arrows
+var hexKeys = []DirectionKey{
+	{ebiten.KeyLeft, DirectionHexLeft},
+	{ebiten.KeyRight, DirectionHexRight},
+	{ebiten.KeyHome, DirectionHexUpLeft},
+	{ebiten.KeyPageUp, DirectionHexUpRight},
+	{ebiten.KeyEnd, DirectionHexDownLeft},
+	{ebiten.KeyPageDown, DirectionHexDownRight},
+	{ebiten.KeyNumpad4, DirectionHexLeft},
+	{ebiten.KeyNumpad6, DirectionHexRight},
+	{ebiten.KeyNumpad7, DirectionHexUpLeft},
+	{ebiten.KeyNumpad9, DirectionHexUpRight},
+	{ebiten.KeyNumpad1, DirectionHexDownLeft},
+	{ebiten.KeyNumpad3, DirectionHexDownRight},
+}
+
+func (t Topology) Directions() []Direction {
+	if t == HexTopology {
+		return HexDirections
+	}
+
+	return Directions
+}
+
+func (t Topology) Keys() []DirectionKey {
+	if t == HexTopology {
+		return hexKeys
+	}
+
+	return squareKeys
+}
+
+// DirectionOf returns the direction of a move in LURD notation, either a
+// walk or a push
+func (t Topology) DirectionOf(move byte) (Direction, bool) {
+	for _, d := range t.Directions() {
+		if move == d.Move || move == d.PushMove() {
+			return d, true
+		}
+	}
+
+	return Direction{}, false
+}
+
+// Size returns the columns and rows of the level definitions, which are
+// the ones that fit in the screen
+func (t Topology) Size() (int, int) {
+	if t == HexTopology {
+		// the last column is only half in the screen
+		rows := (float64(gd.TileSize*gd.TilesY) - float64(gd.TileSize)/2 - 2*hexRadius()) / (1.5 * hexRadius())
+		return 2*gd.TilesX - 1, int(rows) + 1
+	}
+
+	return gd.TilesX, gd.TilesY
+}
+
+// hexRadius is the distance from the center of a hexagon to its corners,
+// for hexagons as wide as a tile
+func hexRadius() float64 {
+	return float64(gd.TileSize) / math.Sqrt(3)
+}
+
+// Center returns the point of the screen where the center of a square is
+func (t Topology) Center(x int, y int) (float64, float64) {
+	size := float64(gd.TileSize)
+	if t == HexTopology {
+		r := hexRadius()
+		return float64(x+1) * size / 2, size/2 + r + float64(y)*1.5*r
+	}
+
+	return float64(x)*size + size/2, float64(y)*size + size
+}
+
+// Origin returns where the top-left corner of the graphics of a square
+// goes in the screen
+func (t Topology) Origin(x int, y int) (float64, float64) {
+	cx, cy := t.Center(x, y)
+	return cx - float64(gd.TileSize)/2, cy - float64(gd.TileSize)/2
+}
+
+// SquareAt returns the square drawn at a point of the screen, which is the
+// one with the nearest center in a hexagonal grid
+func (t Topology) SquareAt(px int, py int) (int, int) {
+	size := float64(gd.TileSize)
+	if t != HexTopology {
+		return px / gd.TileSize, (py - gd.TileSize/2) / gd.TileSize
+	}
+
+	r := hexRadius()
+	row := int(math.Round((float64(py) - size/2 - r) / (1.5 * r)))
+	column := int(math.Round(float64(px)/(size/2))) - 1
+	bestX, bestY, best := -1, -1, math.Inf(1)
+	for y := row - 1; y <= row+1; y++ {
+		for x := column - 1; x <= column+1; x++ {
+			cx, cy := t.Center(x, y)
+			if d := math.Hypot(cx-float64(px), cy-float64(py)); d < best {
+				bestX, bestY, best = x, y, d
+			}
+		}
+	}
+
+	return bestX, bestY
+}
+
+// drawHexTiles draws the tiles of a level as hexagons, cutting them out of
+// the square graphics. Empty squares are left out, since in doubled
+// coordinates half of them are between the hexagons
+func (level *Level) drawHexTiles(screen *ebiten.Image) {
+	r := float32(hexRadius())
+	half := float32(gd.TileSize) / 2
+	indices := []uint16{0, 1, 2, 0, 2, 3, 0, 3, 4, 0, 4, 5, 0, 5, 6, 0, 6, 1}
+
+	for y, row := range level.Tiles {
+		for x, tile := range row {
+			if tile.TileType == TileEmpty {
+				continue
+			}
+
+			cx, cy := HexTopology.Center(x, y)
+			bounds := tile.Image.Bounds()
+			scaleX := float32(bounds.Dx()) / (2 * half)
+			scaleY := float32(bounds.Dy()) / (2 * r)
+
+			vertices := make([]ebiten.Vertex, 0, 7)
+			vertices = append(vertices, hexVertex(float32(cx), float32(cy), 0, 0, bounds.Min.X, bounds.Min.Y, scaleX, scaleY, half, r))
+			for corner := 0; corner < 6; corner++ {
+				angle := math.Pi/180*float64(60*corner) - math.Pi/2
+				dx, dy := float32(math.Cos(angle))*r, float32(math.Sin(angle))*r
+				vertices = append(vertices, hexVertex(float32(cx), float32(cy), dx, dy, bounds.Min.X, bounds.Min.Y, scaleX, scaleY, half, r))
+			}
+
+			screen.DrawTriangles(vertices, indices, tile.Image, nil)
+		}
+	}
+}
+
+// hexVertex is a point of a hexagon at an offset from its center, taking
+// the color of the same point of the tile graphic stretched over the
+// hexagon
+func hexVertex(cx float32, cy float32, dx float32, dy float32, minX int, minY int, scaleX float32, scaleY float32, half float32, r float32) ebiten.Vertex {
+	return ebiten.Vertex{
+		DstX:   cx + dx,
+		DstY:   cy + dy,
+		SrcX:   float32(minX) + (dx+half)*scaleX,
+		SrcY:   float32(minY) + (dy+r)*scaleY,
+		ColorR: 1,
+		ColorG: 1,
+		ColorB: 1,
+		ColorA: 1,
+	}
+}
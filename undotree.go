@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"image/color"
+)
+
+// MoveTree keeps every move played in a level as a tree. Playing after an
+// undo starts a new branch instead of throwing away the moves undone, so
+// every way tried from a position can be gone back to
+type MoveTree struct {
+	Nodes   []MoveNode
+	Current int
+}
+
+// MoveNode is the position after a move. The first node is the start of
+// the level and has no move
+type MoveNode struct {
+	Move     byte
+	Parent   int
+	Children []int
+}
+
+func NewMoveTree() *MoveTree {
+	return &MoveTree{Nodes: []MoveNode{{Parent: -1}}}
+}
+
+// Add goes on from the current node with a move, following the branch that
+// already has it if there is one
+func (t *MoveTree) Add(move byte) {
+	for _, child := range t.Nodes[t.Current].Children {
+		if t.Nodes[child].Move == move {
+			t.Current = child
+			return
+		}
+	}
+
+	t.Nodes = append(t.Nodes, MoveNode{Move: move, Parent: t.Current})
+	child := len(t.Nodes) - 1
+	t.Nodes[t.Current].Children = append(t.Nodes[t.Current].Children, child)
+	t.Current = child
+}
+
+// Back goes to the position before the last move, keeping the branch
+func (t *MoveTree) Back() {
+	if parent := t.Nodes[t.Current].Parent; parent != -1 {
+		t.Current = parent
+	}
+}
+
+// Follow goes to the node reached playing moves from the start, adding the
+// nodes that are missing
+func (t *MoveTree) Follow(moves string) {
+	t.Current = 0
+	for _, move := range []byte(moves) {
+		t.Add(move)
+	}
+}
+
+// Moves returns the moves from the start of the level to a node
+func (t *MoveTree) Moves(node int) string {
+	moves := make([]byte, 0)
+	for ; node > 0; node = t.Nodes[node].Parent {
+		moves = append(moves, t.Nodes[node].Move)
+	}
+
+	for i, j := 0, len(moves)-1; i < j; i, j = i+1, j-1 {
+		moves[i], moves[j] = moves[j], moves[i]
+	}
+
+	return string(moves)
+}
+
+// Branches returns the last node of every branch, in the order they were
+// played
+func (t *MoveTree) Branches() []int {
+	branches := make([]int, 0)
+	for i, node := range t.Nodes {
+		if len(node.Children) == 0 {
+			branches = append(branches, i)
+		}
+	}
+
+	return branches
+}
+
+// forkDepth returns the move where a branch left the one it comes from
+func (t *MoveTree) forkDepth(node int) int {
+	moves := t.Moves(node)
+	depth := len(moves)
+	for ; node > 0; node = t.Nodes[node].Parent {
+		depth--
+		if len(t.Nodes[t.Nodes[node].Parent].Children) > 1 {
+			return countMoves(moves[:depth])
+		}
+	}
+
+	return 0
+}
+
+// countMoves counts the moves in LURD notation, leaving out the numbers
+// that choose the player in levels with several players
+func countMoves(moves string) int {
+	count := 0
+	for _, move := range []byte(moves) {
+		if !isPlayerNumber(move) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// countPushes counts the pushes of moves in LURD notation, which are the
+// upper case moves
+func countPushes(moves string) int {
+	pushes := 0
+	for _, move := range []byte(moves) {
+		if move >= 'A' && move <= 'Z' {
+			pushes++
+		}
+	}
+
+	return pushes
+}
+
+// contains tells if a node is in the way from the start to a branch end
+func (t *MoveTree) contains(branch int, node int) bool {
+	for ; branch != -1; branch = t.Nodes[branch].Parent {
+		if branch == node {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (g *Game) OpenHistory() {
+	g.ShowHistory = true
+	g.SelectedBranch = 0
+
+	tree := g.CurrentLevel.History
+	for i, branch := range tree.Branches() {
+		if tree.contains(branch, tree.Current) {
+			g.SelectedBranch = i
+			break
+		}
+	}
+}
+
+// GoToBranch goes to the end of the selected branch of the history panel
+func (g *Game) GoToBranch() {
+	tree := g.CurrentLevel.History
+	branches := tree.Branches()
+	if g.SelectedBranch >= len(branches) {
+		return
+	}
+
+	g.GoToPosition(tree.Moves(branches[g.SelectedBranch]))
+	g.ShowHistory = false
+}
+
+func (g *Game) DrawHistory(screen *ebiten.Image) {
+	vector.DrawFilledRect(screen, 700, 80, 560, 700, color.RGBA{0x00, 0x00, 0x00, 0xd0}, false)
+
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(720, 100)
+	text.Draw(screen, "History", &text.GoTextFace{Source: mplusFaceSource, Size: 24}, op)
+	op = &text.DrawOptions{}
+	op.GeoM.Translate(720, 140)
+	text.Draw(screen, "Enter: go to branch  U: close", &text.GoTextFace{Source: mplusFaceSource, Size: 12}, op)
+
+	// only the branches around the selected one fit in the panel
+	const rows = 20
+	tree := g.CurrentLevel.History
+	branches := tree.Branches()
+	first := max(0, min(g.SelectedBranch-rows/2, len(branches)-rows))
+	for i := first; i < len(branches) && i < first+rows; i++ {
+		moves := tree.Moves(branches[i])
+		line := fmt.Sprintf("%2d: %d moves, %d pushes", i+1, countMoves(moves), countPushes(moves))
+		if fork := tree.forkDepth(branches[i]); fork > 0 {
+			line += fmt.Sprintf(", from move %d", fork)
+		}
+		if tree.contains(branches[i], tree.Current) {
+			line = "> " + line
+		} else {
+			line = "  " + line
+		}
+
+		op := &text.DrawOptions{}
+		op.GeoM.Translate(720, float64(180+(i-first)*28))
+		if i == g.SelectedBranch {
+			op.ColorScale.ScaleWithColor(color.RGBA{0xff, 0xff, 0x00, 0xff})
+		}
+		text.Draw(screen, line, &text.GoTextFace{Source: mplusFaceSource, Size: 14}, op)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// characters of the XSB format, with the ones the game uses for them
+var xsbCharacters = strings.NewReplacer(
+	"_", " ",
+	"-", " ",
+	"p", "@",
+	"P", "+",
+	"b", "$",
+	"B", "*",
+)
+
+// ReadXSB reads the levels of a pack in XSB format, converting them to the
+// format of the level definitions. Levels that can't be played are left out,
+// and levels that are not enclosed by walls are loaded anyway, since the
+// player can't leave the grid. Both are reported in the returned error.
+// Levels are numbered by their place among the levels loaded, which is the
+// number the commands take, so the levels left out are told by the line
+// they start at
+func ReadXSB(r io.Reader) ([][]string, error) {
+	return readPack(r, SquareTopology)
+}
+
+// ReadHexoban reads a pack in the Hexoban text format, which is XSB with a
+// space between the squares of a row and every other row shifted half a
+// square. Each character is a column of the doubled coordinates of the
+// hexagonal grid, so the rows are read as they are
+func ReadHexoban(r io.Reader) ([][]string, error) {
+	return readPack(r, HexTopology)
+}
+
+func readPack(r io.Reader, topology Topology) ([][]string, error) {
+	levels := make([][]string, 0)
+	errs := make([]error, 0)
+
+	lineNum, start := 0, 0
+	rows := make([]string, 0)
+	addLevel := func() {
+		if len(rows) == 0 {
+			return
+		}
+
+		level, err := parseLevel(rows, topology)
+		rows = rows[:0]
+		if level == nil {
+			errs = append(errs, fmt.Errorf("level at line %d left out: %w", start, err))
+			return
+		}
+
+		levels = append(levels, level)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("level %d: %w", len(levels), err))
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if isXSBRow(line) {
+			if len(rows) == 0 {
+				start = lineNum
+			}
+			rows = append(rows, xsbCharacters.Replace(line))
+		} else {
+			addLevel()
+		}
+	}
+	addLevel()
+
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return levels, errors.Join(errs...)
+}
+
+// ReadXSBFile reads a pack from an XSB file
+func ReadXSBFile(name string) ([][]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadXSB(f)
+}
+
+// ReadHexobanFile reads a pack from a file in the Hexoban text format
+func ReadHexobanFile(name string) ([][]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadHexoban(f)
+}
+
+// isXSBRow tells if a line is part of a level, and not a title, a comment
+// or the empty line between levels. Rows are told by their characters only,
+// since the rows of levels not enclosed by walls can have no walls, but they
+// need a square of the XSB format, so titles like "12" or "sad" made of the
+// letters of special squares are not taken for rows
+func isXSBRow(line string) bool {
+	if !strings.ContainsAny(line, "#@+$*.-_pPbB") {
+		return false
+	}
+
+	return strings.Trim(line, " #@+$*.-_pPbB"+colorGoalLetters+colorBoxLetters+string(iceLetter)+oneWayLetters+teleportLetters+colorBoxOnGoalLetters+colorPlayerOnGoalLetters) == ""
+}
+
+func parseLevel(rows []string, topology Topology) ([]string, error) {
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	maxWidth, maxHeight := topology.Size()
+	if width > maxWidth || len(rows) > maxHeight {
+		return nil, fmt.Errorf("level is bigger than %dx%d", maxWidth, maxHeight)
+	}
+
+	for i, row := range rows {
+		rows[i] = row + strings.Repeat(" ", width-len(row))
+	}
+	players := countPlayers(rows)
+	if players == 0 {
+		return nil, errors.New("level has no player")
+	}
+	if players > maxPlayers {
+		return nil, fmt.Errorf("level has %d players, more than %d", players, maxPlayers)
+	}
+
+	level, enclosed := fillFloor(rows, topology)
+	if !enclosed {
+		return padRows(level, maxWidth, maxHeight), errors.New("level is not enclosed by walls")
+	}
+
+	return padRows(level, maxWidth, maxHeight), nil
+}
+
+// WriteXSB writes levels in the XSB text format used by most Sokoban
+// programs: floor is a space and every level starts with a title comment
+func WriteXSB(w io.Writer, levels [][]string, titles []string) error {
+	bw := bufio.NewWriter(w)
+	for i, rows := range levels {
+		if i < len(titles) {
+			bw.WriteString("; " + titles[i] + "\n\n")
+		}
+
+		for _, row := range cropLevel(rows) {
+			row = strings.ReplaceAll(row, "-", " ")
+			bw.WriteString(strings.TrimRight(row, " ") + "\n")
+		}
+		bw.WriteString("\n")
+	}
+
+	return bw.Flush()
+}
+
+// cropLevel removes the empty rows and columns around a level definition
+func cropLevel(rows []string) []string {
+	top, bottom := -1, -1
+	left, right := len(rows[0]), -1
+	for y, row := range rows {
+		trimmed := strings.TrimSpace(row)
+		if trimmed == "" {
+			continue
+		}
+
+		if top == -1 {
+			top = y
+		}
+		bottom = y
+		left = min(left, strings.Index(row, trimmed))
+		right = max(right, strings.Index(row, trimmed)+len(trimmed))
+	}
+
+	if top == -1 {
+		return nil
+	}
+
+	cropped := make([]string, 0, bottom-top+1)
+	for _, row := range rows[top : bottom+1] {
+		cropped = append(cropped, row[left:min(right, len(row))])
+	}
+
+	return cropped
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadXSB(t *testing.T) {
+	tests := []struct {
+		name   string
+		xsb    string
+		levels int
+		rows   int
+		err    string
+	}{
+		{
+			name: "titles and blank lines",
+			xsb: "; First\n\n#####\n#@$.#\n#####\n\n" +
+				"Title: Second\n#####\n#.$@#\n#####\n",
+			levels: 2,
+		},
+		{
+			name: "titles made of level letters",
+			xsb: "1\n#####\n#@$.#\n#####\n\n" +
+				"12\n#####\n#.$@#\n#####\n" +
+				"sad\n#####\n#@$.#\n#####\n",
+			levels: 3,
+			rows:   3,
+		},
+		{
+			name:   "levels only separated by a blank line",
+			xsb:    "#####\n#@$.#\n#####\n\n#####\n#.$@#\n#####\n",
+			levels: 2,
+		},
+		{
+			name:   "xsb characters",
+			xsb:    "######\n#p_b.#\n#__B_#\n######\n",
+			levels: 1,
+		},
+		{
+			name:   "row without walls",
+			xsb:    "####\n-@$.\n####\n",
+			levels: 1,
+			err:    "level 1: level is not enclosed by walls",
+		},
+		{
+			name:   "no player",
+			xsb:    "#####\n#-$.#\n#####\n\n#####\n#@$.#\n#####\n",
+			levels: 1,
+			err:    "level at line 1 left out: level has no player",
+		},
+		{
+			name: "numbered without the levels left out",
+			xsb: "; One\n#####\n#-$.#\n#####\n\n" +
+				"; Two\n####\n-@$.\n####\n",
+			levels: 1,
+			err: "level at line 2 left out: level has no player\n" +
+				"level 1: level is not enclosed by walls",
+		},
+		{
+			name:   "too many players",
+			xsb:    "############\n#@@@@@@@@@@#\n############\n",
+			levels: 0,
+			err:    "level at line 1 left out: level has 10 players, more than 9",
+		},
+		{
+			name:   "too big",
+			xsb:    "#" + strings.Repeat("-", 20) + "#\n#@$.#\n#####\n",
+			levels: 0,
+			err:    "level at line 1 left out: level is bigger than 20x17",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			levels, err := ReadXSB(strings.NewReader(tt.xsb))
+			if len(levels) != tt.levels {
+				t.Errorf("ReadXSB read %d levels, want %d", len(levels), tt.levels)
+			}
+			for i, level := range levels {
+				if n := len(cropLevel(level)); tt.rows != 0 && n != tt.rows {
+					t.Errorf("level %d has %d rows, want %d", i+1, n, tt.rows)
+				}
+			}
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("ReadXSB failed: %v", err)
+			case tt.err != "" && (err == nil || err.Error() != tt.err):
+				t.Errorf("ReadXSB error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []string
+		want []string
+	}{
+		{
+			name: "floor filled from the player",
+			rows: []string{"#####", "#@ .#", "#####"},
+			want: []string{"#####", "#@-.#", "#####"},
+		},
+		{
+			name: "outside squares kept empty",
+			rows: []string{"  #####", "###  $#", "#@  . #", "#######"},
+			want: []string{"  #####", "###--$#", "#@--.-#", "#######"},
+		},
+		{
+			name: "short rows padded",
+			rows: []string{"####", "#@.#", "# $##", "#####"},
+			want: []string{"#### ", "#@.# ", "#-$##", "#####"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, err := parseLevel(tt.rows, SquareTopology)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			width, height := SquareTopology.Size()
+			if len(level) != height {
+				t.Fatalf("parseLevel returned %d rows, want %d", len(level), height)
+			}
+			for y, row := range level {
+				if len(row) != width {
+					t.Fatalf("row %d has %d squares, want %d", y+1, len(row), width)
+				}
+			}
+
+			// the level is centered in the padding
+			got := cropLevel(level)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("parseLevel = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}